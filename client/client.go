@@ -0,0 +1,276 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strings"
+	"time"
+
+	"connectrpc.com/connect"
+	"golang.org/x/oauth2"
+	"google.golang.org/api/idtoken"
+
+	"github.com/curioswitch/go-curiostack/config"
+	"github.com/curioswitch/go-curiostack/otel"
+)
+
+const (
+	defaultInitialBackoff = 100 * time.Millisecond
+	defaultMaxBackoff     = 5 * time.Second
+)
+
+var (
+	errUnknownClient   = errors.New("unknown client")
+	errMissingAddress  = errors.New("address not configured")
+	errInvalidProtocol = errors.New("invalid protocol")
+	errInvalidAuth     = errors.New("invalid auth")
+)
+
+// newIDTokenSource creates the token source for "google" auth, replaced in tests.
+var newIDTokenSource = func(ctx context.Context, audience string) (oauth2.TokenSource, error) {
+	return idtoken.NewTokenSource(ctx, audience)
+}
+
+// New returns a connect client for the client configured with name in
+// config.Common.Clients. newClient is the constructor of the client from connect
+// generated code, such as curioapiconnect.NewCurioServiceClient. opts are added after
+// the options for the configuration.
+//
+// Calls are instrumented with tracing and metrics, and authenticated, bounded by a
+// timeout and retried as configured.
+func New[T any](
+	ctx context.Context,
+	conf *config.Common,
+	name string,
+	newClient func(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) T,
+	opts ...connect.ClientOption,
+) (T, error) {
+	var zero T
+
+	c, ok := conf.Clients[name]
+	if !ok {
+		return zero, fmt.Errorf("client: %w: %s", errUnknownClient, name)
+	}
+	if c.Address == "" {
+		return zero, fmt.Errorf("client: %w for %s", errMissingAddress, name)
+	}
+
+	var clientOpts []connect.ClientOption
+	switch strings.ToLower(c.Protocol) {
+	case "", "connect":
+	case "grpc":
+		clientOpts = append(clientOpts, connect.WithGRPC())
+	case "grpcweb":
+		clientOpts = append(clientOpts, connect.WithGRPCWeb())
+	default:
+		return zero, fmt.Errorf("client: %w for %s: %q", errInvalidProtocol, name, c.Protocol)
+	}
+
+	interceptors := []connect.Interceptor{otel.ConnectClientInterceptor()}
+	if c.Timeout > 0 {
+		interceptors = append(interceptors, &timeoutInterceptor{timeout: c.Timeout})
+	}
+	if c.Retry.MaxAttempts > 1 {
+		interceptors = append(interceptors, newRetryInterceptor(&c.Retry))
+	}
+
+	switch strings.ToLower(c.Auth) {
+	case "", "none":
+	case "google":
+		audience := c.Audience
+		if audience == "" {
+			audience = c.Address
+		}
+		ts, err := newIDTokenSource(ctx, audience)
+		if err != nil {
+			return zero, fmt.Errorf("client: creating ID token source for %s: %w", name, err)
+		}
+		interceptors = append(interceptors, &authInterceptor{token: func(context.Context) (string, error) {
+			t, err := ts.Token()
+			if err != nil {
+				return "", fmt.Errorf("client: fetching ID token: %w", err)
+			}
+			return t.AccessToken, nil
+		}})
+	case "forward":
+		interceptors = append(interceptors, &authInterceptor{token: forwardedToken})
+	default:
+		return zero, fmt.Errorf("client: %w for %s: %q", errInvalidAuth, name, c.Auth)
+	}
+
+	h2c := c.H2C || strings.EqualFold(c.Protocol, "grpc")
+
+	clientOpts = append(clientOpts, connect.WithInterceptors(interceptors...))
+	clientOpts = append(clientOpts, opts...)
+
+	return newClient(newHTTPClient(c.Address, h2c), strings.TrimSuffix(c.Address, "/"), clientOpts...), nil
+}
+
+// newHTTPClient returns an HTTP client for calling address, using HTTP/2 when possible.
+// Plain "http" addresses use HTTP/1.1 unless h2c is set, as HTTP/2 without TLS cannot
+// be negotiated.
+func newHTTPClient(address string, h2c bool) *http.Client {
+	protocols := &http.Protocols{}
+	if strings.HasPrefix(address, "http://") {
+		if h2c {
+			protocols.SetUnencryptedHTTP2(true)
+		} else {
+			protocols.SetHTTP1(true)
+		}
+	} else {
+		protocols.SetHTTP1(true)
+		protocols.SetHTTP2(true)
+	}
+
+	transport, _ := http.DefaultTransport.(*http.Transport)
+	transport = transport.Clone()
+	transport.Protocols = protocols
+	return &http.Client{Transport: transport}
+}
+
+// forwardedToken returns the bearer token of the request being handled by the server.
+func forwardedToken(ctx context.Context) (string, error) {
+	info, ok := connect.CallInfoForHandlerContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	scheme, token, ok := strings.Cut(info.RequestHeader().Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", nil
+	}
+	return strings.TrimSpace(token), nil
+}
+
+// authInterceptor sets a bearer token on calls.
+type authInterceptor struct {
+	token func(ctx context.Context) (string, error)
+}
+
+func (i *authInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if err := i.setToken(ctx, req.Header()); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *authInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return func(ctx context.Context, spec connect.Spec) connect.StreamingClientConn {
+		conn := next(ctx, spec)
+		if err := i.setToken(ctx, conn.RequestHeader()); err != nil {
+			return &errorClientConn{StreamingClientConn: conn, err: err}
+		}
+		return conn
+	}
+}
+
+func (i *authInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+func (i *authInterceptor) setToken(ctx context.Context, header http.Header) error {
+	token, err := i.token(ctx)
+	if err != nil {
+		return connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	if token != "" {
+		header.Set("Authorization", "Bearer "+token)
+	}
+	return nil
+}
+
+// errorClientConn fails a stream before sending any messages.
+type errorClientConn struct {
+	connect.StreamingClientConn
+
+	err error
+}
+
+func (c *errorClientConn) Send(any) error {
+	return c.err
+}
+
+func (c *errorClientConn) Receive(any) error {
+	return c.err
+}
+
+// timeoutInterceptor bounds the duration of unary calls.
+type timeoutInterceptor struct {
+	timeout time.Duration
+}
+
+func (i *timeoutInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx, cancel := context.WithTimeout(ctx, i.timeout)
+		defer cancel()
+		return next(ctx, req)
+	}
+}
+
+func (i *timeoutInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *timeoutInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
+
+// retryInterceptor retries unary calls to idempotent methods that fail with an
+// unavailable error, with exponential backoff and full jitter.
+type retryInterceptor struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+func newRetryInterceptor(conf *config.ClientRetry) *retryInterceptor {
+	i := &retryInterceptor{
+		maxAttempts:    conf.MaxAttempts,
+		initialBackoff: conf.InitialBackoff,
+		maxBackoff:     conf.MaxBackoff,
+	}
+	if i.initialBackoff <= 0 {
+		i.initialBackoff = defaultInitialBackoff
+	}
+	if i.maxBackoff <= 0 {
+		i.maxBackoff = defaultMaxBackoff
+	}
+	return i
+}
+
+func (i *retryInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if req.Spec().IdempotencyLevel == connect.IdempotencyUnknown {
+			return next(ctx, req)
+		}
+
+		backoff := i.initialBackoff
+		for attempt := 1; ; attempt++ {
+			res, err := next(ctx, req)
+			if err == nil || attempt >= i.maxAttempts || connect.CodeOf(err) != connect.CodeUnavailable {
+				return res, err
+			}
+
+			t := time.NewTimer(rand.N(backoff) + 1) //nolint:gosec // jitter does not need a secure random
+			select {
+			case <-ctx.Done():
+				t.Stop()
+				return nil, err
+			case <-t.C:
+			}
+			backoff = min(backoff*2, i.maxBackoff)
+		}
+	}
+}
+
+func (i *retryInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *retryInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
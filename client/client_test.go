@@ -0,0 +1,243 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+type healthClient = *connect.Client[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse]
+
+func newHealthClient(httpClient connect.HTTPClient, baseURL string, opts ...connect.ClientOption) healthClient {
+	return connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		httpClient, baseURL+healthpb.Health_Check_FullMethodName, opts...)
+}
+
+// newTestBackend starts a server supporting HTTP/1.1 and h2c for the health check
+// procedure, responding with SERVING if the request has the bearer token "backend-token".
+// The first failures calls fail with an unavailable error, and each call waits for delay.
+// The major HTTP version of the last call is also returned.
+func newTestBackend(t *testing.T, failures int32, delay time.Duration) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	var protoMajor atomic.Int32
+	mux := http.NewServeMux()
+	mux.Handle(healthpb.Health_Check_FullMethodName, connect.NewUnaryHandler(
+		healthpb.Health_Check_FullMethodName,
+		func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+			if calls.Add(1) <= failures {
+				return nil, connect.NewError(connect.CodeUnavailable, nil)
+			}
+			select {
+			case <-ctx.Done():
+				return nil, connect.NewError(connect.CodeDeadlineExceeded, ctx.Err())
+			case <-time.After(delay):
+			}
+			status := healthpb.HealthCheckResponse_NOT_SERVING
+			if req.Header().Get("Authorization") == "Bearer backend-token" {
+				status = healthpb.HealthCheckResponse_SERVING
+			}
+			return connect.NewResponse(&healthpb.HealthCheckResponse{Status: status}), nil
+		},
+	))
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		protoMajor.Store(int32(r.ProtoMajor)) //nolint:gosec // always 1 or 2
+		mux.ServeHTTP(w, r)
+	}))
+	srv.Config.Protocols = &http.Protocols{}
+	srv.Config.Protocols.SetHTTP1(true)
+	srv.Config.Protocols.SetUnencryptedHTTP2(true)
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	return srv, &calls, &protoMajor
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name     string
+		client   config.Client
+		failures int32
+		delay    time.Duration
+		opts     []connect.ClientOption
+
+		status     healthpb.HealthCheckResponse_ServingStatus
+		code       connect.Code
+		calls      int32
+		protoMajor int32
+	}{
+		{
+			name:       "connect",
+			client:     config.Client{},
+			status:     healthpb.HealthCheckResponse_NOT_SERVING,
+			calls:      1,
+			protoMajor: 1,
+		},
+		{
+			name:       "connect h2c",
+			client:     config.Client{H2C: true},
+			status:     healthpb.HealthCheckResponse_NOT_SERVING,
+			calls:      1,
+			protoMajor: 2,
+		},
+		{
+			name:       "grpc",
+			client:     config.Client{Protocol: "grpc"},
+			status:     healthpb.HealthCheckResponse_NOT_SERVING,
+			calls:      1,
+			protoMajor: 2,
+		},
+		{
+			name:       "grpc-web",
+			client:     config.Client{Protocol: "grpcweb"},
+			status:     healthpb.HealthCheckResponse_NOT_SERVING,
+			calls:      1,
+			protoMajor: 1,
+		},
+		{
+			name:   "google auth",
+			client: config.Client{Auth: "google"},
+			status: healthpb.HealthCheckResponse_SERVING,
+			calls:  1,
+		},
+		{
+			name:   "timeout",
+			client: config.Client{Timeout: 10 * time.Millisecond},
+			delay:  time.Second,
+			code:   connect.CodeDeadlineExceeded,
+			calls:  1,
+		},
+		{
+			name:     "retry",
+			client:   config.Client{Retry: config.ClientRetry{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+			failures: 2,
+			opts:     []connect.ClientOption{connect.WithIdempotency(connect.IdempotencyNoSideEffects)},
+			status:   healthpb.HealthCheckResponse_NOT_SERVING,
+			calls:    3,
+		},
+		{
+			name:     "retry exhausted",
+			client:   config.Client{Retry: config.ClientRetry{MaxAttempts: 2, InitialBackoff: time.Millisecond}},
+			failures: 2,
+			opts:     []connect.ClientOption{connect.WithIdempotency(connect.IdempotencyIdempotent)},
+			code:     connect.CodeUnavailable,
+			calls:    2,
+		},
+		{
+			name:     "no retry without idempotency",
+			client:   config.Client{Retry: config.ClientRetry{MaxAttempts: 3, InitialBackoff: time.Millisecond}},
+			failures: 2,
+			code:     connect.CodeUnavailable,
+			calls:    1,
+		},
+	}
+
+	origIDTokenSource := newIDTokenSource
+	t.Cleanup(func() { newIDTokenSource = origIDTokenSource })
+	newIDTokenSource = func(_ context.Context, audience string) (oauth2.TokenSource, error) {
+		require.NotEmpty(t, audience)
+		return oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "backend-token"}), nil
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv, calls, protoMajor := newTestBackend(t, tc.failures, tc.delay)
+
+			tc.client.Address = srv.URL
+			conf := &config.Common{Clients: map[string]config.Client{"backend": tc.client}}
+			client, err := New(t.Context(), conf, "backend", newHealthClient, tc.opts...)
+			require.NoError(t, err)
+
+			res, err := client.CallUnary(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+			require.Equal(t, tc.calls, calls.Load())
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.status, res.Msg.GetStatus())
+			if tc.protoMajor != 0 {
+				require.Equal(t, tc.protoMajor, protoMajor.Load())
+			}
+		})
+	}
+}
+
+func TestNewForwardAuth(t *testing.T) {
+	backend, _, _ := newTestBackend(t, 0, 0)
+
+	conf := &config.Common{Clients: map[string]config.Client{
+		"backend": {Address: backend.URL, Auth: "forward"},
+	}}
+	client, err := New(t.Context(), conf, "backend", newHealthClient)
+	require.NoError(t, err)
+
+	// A frontend server calling the backend while handling a request.
+	frontend := httptest.NewServer(connect.NewUnaryHandler(
+		healthpb.Health_Check_FullMethodName,
+		func(ctx context.Context, req *connect.Request[healthpb.HealthCheckRequest]) (*connect.Response[healthpb.HealthCheckResponse], error) {
+			return client.CallUnary(ctx, connect.NewRequest(req.Msg))
+		},
+	))
+	defer frontend.Close()
+
+	for _, token := range []string{"backend-token", ""} {
+		req := connect.NewRequest(&healthpb.HealthCheckRequest{})
+		want := healthpb.HealthCheckResponse_NOT_SERVING
+		if token != "" {
+			req.Header().Set("Authorization", "Bearer "+token)
+			want = healthpb.HealthCheckResponse_SERVING
+		}
+		res, err := newHealthClient(http.DefaultClient, frontend.URL).CallUnary(t.Context(), req)
+		require.NoError(t, err)
+		require.Equal(t, want, res.Msg.GetStatus())
+	}
+}
+
+func TestNewInvalidConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		client config.Client
+
+		err error
+	}{
+		{
+			name:   "missing address",
+			client: config.Client{},
+			err:    errMissingAddress,
+		},
+		{
+			name:   "invalid protocol",
+			client: config.Client{Address: "http://localhost:8080", Protocol: "http3"},
+			err:    errInvalidProtocol,
+		},
+		{
+			name:   "invalid auth",
+			client: config.Client{Address: "http://localhost:8080", Auth: "basic"},
+			err:    errInvalidAuth,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			conf := &config.Common{Clients: map[string]config.Client{"backend": tc.client}}
+			_, err := New(t.Context(), conf, "backend", newHealthClient)
+			require.ErrorIs(t, err, tc.err)
+		})
+	}
+
+	_, err := New(t.Context(), &config.Common{}, "backend", newHealthClient)
+	require.ErrorIs(t, err, errUnknownClient)
+}
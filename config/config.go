@@ -2,12 +2,15 @@ package config
 
 import (
 	_ "embed"
+	"errors"
 	"fmt"
 	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/knadh/koanf/parsers/yaml"
@@ -19,11 +22,359 @@ import (
 //go:embed config.yaml
 var defaults []byte
 
+//go:embed config-local.yaml
+var defaultsLocal []byte
+
 // Server holds the configuration for the server.
 type Server struct {
 	// Address is the address the server will listen on, e.g. ":9080".
 	// Defaults to ":8080".
 	Address string `koanf:"address"`
+
+	// AdminAddress is an optional address, e.g. ":8081", to serve /internal/ endpoints
+	// such as docs and health checks on, along with gRPC health checks and reflection.
+	// When set, these endpoints are not served on Address, allowing them to be kept
+	// unreachable from public ingress.
+	AdminAddress string `koanf:"adminAddress"`
+
+	// ReadTimeout is the maximum duration for reading an entire request, including
+	// the body. Defaults to no timeout.
+	ReadTimeout time.Duration `koanf:"readTimeout"`
+
+	// ReadHeaderTimeout is the maximum duration for reading request headers.
+	// Defaults to 3s.
+	ReadHeaderTimeout time.Duration `koanf:"readHeaderTimeout"`
+
+	// WriteTimeout is the maximum duration before timing out writes of a response.
+	// Note that this also bounds the duration of streaming responses. Defaults to
+	// no timeout.
+	WriteTimeout time.Duration `koanf:"writeTimeout"`
+
+	// IdleTimeout is the maximum amount of time to wait for the next request on
+	// a keep-alive connection. Defaults to ReadTimeout.
+	IdleTimeout time.Duration `koanf:"idleTimeout"`
+
+	// MaxHeaderBytes is the maximum size of request headers. Defaults to 1MiB.
+	MaxHeaderBytes ByteSize `koanf:"maxHeaderBytes"`
+
+	// MaxRequestBytes is the maximum size of a request body, or for connect procedures,
+	// of each request message so streams are not limited in total. Requests with larger
+	// bodies or messages will fail. Individual connect procedures may override this. Set
+	// to 0 to disable the limit. Defaults to 4MiB.
+	MaxRequestBytes ByteSize `koanf:"maxRequestBytes"`
+
+	// DrainTimeout is the maximum time to wait for in-flight requests to complete
+	// when shutting down the server, and then for background workers to stop.
+	// Defaults to 10s.
+	DrainTimeout time.Duration `koanf:"drainTimeout"`
+
+	// ShutdownDelay is the time to wait after health checks start failing before the
+	// server stops accepting connections on shutdown, allowing load balancers to observe
+	// the failing health checks and stop sending new requests. Defaults to 5s, or 0 for
+	// local development.
+	ShutdownDelay time.Duration `koanf:"shutdownDelay"`
+
+	// Timeouts holds the configuration for timeouts of unary connect procedures.
+	Timeouts Timeouts `koanf:"timeouts"`
+
+	// HookTimeout is the maximum time each lifecycle hook, registered with server.OnStart
+	// or server.OnShutdown, may take to run. Defaults to 10s.
+	HookTimeout time.Duration `koanf:"hookTimeout"`
+
+	// Health holds the configuration for health checks.
+	Health Health `koanf:"health"`
+
+	// EnableReflection enables gRPC server reflection for services registered on the
+	// server, allowing tools like grpcurl and buf curl to discover them. Defaults to
+	// true for local development and false otherwise.
+	EnableReflection bool `koanf:"enableReflection"`
+
+	// ValidateResponses enables validating response messages from connect handlers
+	// against the buf.validate constraints declared in their protos, failing with an
+	// internal error when invalid to catch server bugs. Defaults to true for local
+	// development and false otherwise.
+	ValidateResponses bool `koanf:"validateResponses"`
+
+	// TLS holds the configuration for serving HTTPS. Certificate files are reloaded
+	// when changed on disk without restarting the server.
+	TLS TLS `koanf:"tls"`
+
+	// Auth holds the configuration for authenticating requests with JWTs.
+	Auth Auth `koanf:"auth"`
+
+	// CORS holds the configuration for allowing cross-origin requests from browsers.
+	CORS CORS `koanf:"cors"`
+
+	// OpenAPI holds the configuration for the OpenAPI document describing the connect
+	// procedures registered on the server.
+	OpenAPI OpenAPI `koanf:"openapi"`
+
+	// DocsAuth holds the configuration for authorizing requests sent from the docs
+	// handler. It is ignored if server.EnableDocsAuth is called.
+	DocsAuth DocsAuth `koanf:"docsAuth"`
+
+	// Internal holds the configuration for protecting /internal/ endpoints, such as the
+	// docs handler.
+	Internal Internal `koanf:"internal"`
+}
+
+// Internal holds the configuration for protecting /internal/ endpoints, such as the docs
+// handler. Health check endpoints are never protected so probes can always reach them.
+// It is generally set per environment, for example to allow docs in staging while
+// disabling them in production.
+type Internal struct {
+	// DisableDocs disables the docs handler and OpenAPI document.
+	DisableDocs bool `koanf:"disableDocs"`
+
+	// AllowedIPs are the IP addresses or CIDR ranges, such as "10.0.0.0/8", allowed to
+	// access /internal/ endpoints. Requests from other addresses fail with 403 Forbidden.
+	// Defaults to allowing any address.
+	AllowedIPs []string `koanf:"allowedIPs"`
+
+	// TrustedProxies is the number of proxies in front of the server, such as a load
+	// balancer, which append the address of their client to X-Forwarded-For. The client
+	// address for AllowedIPs is read from X-Forwarded-For when set, and from the
+	// connection otherwise. Defaults to 0.
+	TrustedProxies int `koanf:"trustedProxies"`
+
+	// BasicAuth holds credentials required to access /internal/ endpoints with HTTP basic
+	// auth. If RequireIdentity is also set, either is accepted.
+	BasicAuth BasicAuth `koanf:"basicAuth"`
+
+	// RequireIdentity requires requests to /internal/ endpoints to have a bearer token
+	// verified by the server, from an issuer in Auth or Firebase if
+	// server.RequireFirebaseAuth is enabled. If BasicAuth is also set, either is accepted.
+	RequireIdentity bool `koanf:"requireIdentity"`
+
+	// AllowedIdentities are the subjects, Firebase user IDs or email addresses allowed
+	// when RequireIdentity is set. Email addresses only match when the token has the
+	// email_verified claim. Defaults to allowing any verified identity.
+	AllowedIdentities []string `koanf:"allowedIdentities"`
+
+	// LogAccess logs requests to protected /internal/ endpoints, including denied ones.
+	LogAccess bool `koanf:"logAccess"`
+}
+
+// BasicAuth holds credentials for HTTP basic auth. It is disabled when Username is empty.
+type BasicAuth struct {
+	// Username is the required username.
+	Username string `koanf:"username"`
+
+	// Password is the required password. It must be set if Username is. It should be set
+	// with an environment variable or secret rather than in config files.
+	Password string `koanf:"password"`
+}
+
+// DocsAuth holds the configuration for authorizing requests sent from the docs handler.
+type DocsAuth struct {
+	// Provider is the provider of credentials, one of "bearer" for a bearer token entered
+	// in the docs, "apiKey" for an API key entered in the docs, "oidc" or "google" for an
+	// ID token from the OpenID Connect implicit flow, or "firebase" for a Firebase ID
+	// token. Defaults to no auth.
+	Provider string `koanf:"provider"`
+
+	// APIKeyHeader is the header to send the API key in for the "apiKey" provider.
+	// Defaults to "X-API-Key".
+	APIKeyHeader string `koanf:"apiKeyHeader"`
+
+	// OIDC holds the configuration for the "oidc" and "google" providers.
+	OIDC DocsOIDCAuth `koanf:"oidc"`
+
+	// Firebase holds the configuration for the "firebase" provider.
+	Firebase DocsFirebaseAuth `koanf:"firebase"`
+}
+
+// DocsOIDCAuth holds the configuration for signing in to the docs handler with the
+// OpenID Connect implicit flow. The docs URL, such as "http://localhost:8080/internal/docs/",
+// must be an allowed redirect URI of the client.
+type DocsOIDCAuth struct {
+	// AuthorizationURL is the authorization endpoint of the provider. Defaults to Google's
+	// for the "google" provider.
+	AuthorizationURL string `koanf:"authorizationURL"`
+
+	// ClientID is the ID of the OAuth client.
+	ClientID string `koanf:"clientID"`
+}
+
+// DocsFirebaseAuth holds the configuration for sending Firebase ID tokens from the docs
+// handler. The user signed in with the Firebase JS SDK, generally by running the actual
+// web app on the same origin, is used.
+type DocsFirebaseAuth struct {
+	// AuthDomain is the auth domain of the Firebase project, e.g. "example.firebaseapp.com".
+	AuthDomain string `koanf:"authDomain"`
+
+	// APIKey is the web API key of the Firebase project. If unset, the Firebase JS SDK and
+	// config of the project are loaded from the reserved /__/firebase/ URLs of the auth
+	// domain instead.
+	APIKey string `koanf:"apiKey"`
+
+	// EmulatorURL is the URL of the Firebase Auth emulator to use, e.g.
+	// "http://localhost:9099". Defaults to not using the emulator.
+	EmulatorURL string `koanf:"emulatorURL"`
+
+	// SDKVersion is the version of the Firebase JS SDK to load when APIKey is set. Defaults
+	// to "10.14.1".
+	SDKVersion string `koanf:"sdkVersion"`
+}
+
+// OpenAPI holds the configuration for the OpenAPI document describing the connect
+// procedures registered on the server, served at /internal/openapi.json.
+type OpenAPI struct {
+	// Title is the title of the API. Defaults to the names of the registered services.
+	Title string `koanf:"title"`
+
+	// Version is the version of the API. Defaults to "1.0.0".
+	Version string `koanf:"version"`
+
+	// OutputFile is a path to write the OpenAPI document to instead of starting the
+	// server, as used by the openapi task. Generally set with the environment variable
+	// SERVER_OPENAPI_OUTPUTFILE rather than in config files. The setup before calling
+	// server.Start is still run, so it must not require external resources such as
+	// databases when set, e.g. by only connecting to them lazily or when it is empty.
+	OutputFile string `koanf:"outputFile"`
+}
+
+// CORS holds the configuration for allowing cross-origin requests from browsers, such
+// as from connect-web clients served from a different origin. The headers used by the
+// connect and gRPC-web protocols are always allowed and exposed.
+type CORS struct {
+	// AllowedOrigins are the origins allowed to make cross-origin requests, such as
+	// "https://example.com". An origin may contain one wildcard, such as
+	// "https://*.example.com", and "*" allows any origin. CORS is disabled when empty.
+	AllowedOrigins []string `koanf:"allowedOrigins"`
+
+	// AllowedHeaders are request headers to allow in addition to the protocol headers
+	// and Authorization.
+	AllowedHeaders []string `koanf:"allowedHeaders"`
+
+	// ExposedHeaders are response headers to expose in addition to the protocol headers.
+	ExposedHeaders []string `koanf:"exposedHeaders"`
+
+	// AllowCredentials allows requests with credentials such as cookies. It should
+	// only be enabled with specific AllowedOrigins.
+	AllowCredentials bool `koanf:"allowCredentials"`
+
+	// MaxAge is how long browsers may cache the result of a preflight request.
+	// Defaults to 2h.
+	MaxAge time.Duration `koanf:"maxAge"`
+}
+
+// Timeouts holds the configuration for timeouts of unary connect procedures. When a
+// procedure times out, its context is canceled and it fails with a deadline exceeded
+// error. A shorter deadline set by the client takes precedence. Streaming procedures
+// are not bounded by these timeouts.
+type Timeouts struct {
+	// Default is the timeout for procedures without a timeout in Procedures. Set to 0
+	// for no timeout. Defaults to 30s.
+	Default time.Duration `koanf:"default"`
+
+	// Procedures are the timeouts for individual procedures, overriding Default.
+	Procedures []ProcedureTimeout `koanf:"procedures"`
+}
+
+// ProcedureTimeout is the timeout for a connect procedure.
+type ProcedureTimeout struct {
+	// Procedure is the full name of the procedure, e.g. "/curioapi.CurioService/GetCurio".
+	Procedure string `koanf:"procedure"`
+
+	// Timeout is the timeout for the procedure. Set to 0 for no timeout.
+	Timeout time.Duration `koanf:"timeout"`
+}
+
+// Auth holds the configuration for authenticating requests with JWTs.
+type Auth struct {
+	// Issuers are the trusted issuers of JWTs. When set, requests to connect procedures
+	// must have a bearer token from one of them unless the procedure's policy allows
+	// public access.
+	Issuers []Issuer `koanf:"issuers"`
+}
+
+// Issuer holds the configuration for verifying JWTs from an issuer.
+type Issuer struct {
+	// Issuer is the expected "iss" claim of tokens, e.g. "https://accounts.google.com".
+	Issuer string `koanf:"issuer"`
+
+	// JWKSURL is the URL of the JSON Web Key Set used to verify tokens. Defaults to the
+	// jwks_uri of the issuer's OpenID configuration.
+	JWKSURL string `koanf:"jwksURL"`
+
+	// Audiences are the accepted values of the "aud" claim of tokens. At least one
+	// is required.
+	Audiences []string `koanf:"audiences"`
+
+	// RolesClaim is the claim containing the roles of the caller, either an array or a
+	// space-separated string. Defaults to "roles".
+	RolesClaim string `koanf:"rolesClaim"`
+}
+
+// ByteSize is a size in bytes. It can be decoded from a plain number of bytes or a
+// number with a unit suffix, such as "512KB" or "4MiB". Units with an "i" are
+// powers of 1024, others are powers of 1000.
+type ByteSize int64
+
+var errInvalidByteSize = errors.New("invalid byte size")
+
+var byteSizeUnits = map[string]int64{
+	"":    1,
+	"b":   1,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"kib": 1 << 10,
+	"mib": 1 << 20,
+	"gib": 1 << 30,
+}
+
+// UnmarshalText implements [encoding.TextUnmarshaler].
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	s := strings.TrimSpace(string(text))
+	numEnd := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if numEnd == -1 {
+		numEnd = len(s)
+	}
+
+	unit, ok := byteSizeUnits[strings.ToLower(strings.TrimSpace(s[numEnd:]))]
+	if !ok {
+		return fmt.Errorf("config: %w, unknown unit: %q", errInvalidByteSize, s)
+	}
+	n, err := strconv.ParseFloat(s[:numEnd], 64)
+	if err != nil {
+		return fmt.Errorf("config: %w: %q: %w", errInvalidByteSize, s, err)
+	}
+
+	*b = ByteSize(n * float64(unit))
+	return nil
+}
+
+// TLS holds the configuration for serving HTTPS.
+type TLS struct {
+	// CertFile is the path to the PEM-encoded certificate chain to serve. TLS is
+	// enabled when this is set.
+	CertFile string `koanf:"certFile"`
+
+	// KeyFile is the path to the PEM-encoded private key for the certificate.
+	KeyFile string `koanf:"keyFile"`
+
+	// ClientCAFile is the path to PEM-encoded CA certificates used to verify client
+	// certificates. When set, clients must present a valid certificate (mTLS).
+	ClientCAFile string `koanf:"clientCAFile"`
+
+	// MinVersion is the minimum TLS version to accept, either "1.2" or "1.3".
+	// Defaults to "1.2".
+	MinVersion string `koanf:"minVersion"`
+}
+
+// Health holds the configuration for health checks.
+type Health struct {
+	// Timeout is the maximum time a single health check may take before it is
+	// considered failed. Defaults to 5s.
+	Timeout time.Duration `koanf:"timeout"`
+
+	// CacheDuration is how long the result of running health checks is reused
+	// before running them again. Defaults to 1s.
+	CacheDuration time.Duration `koanf:"cacheDuration"`
 }
 
 // Google holds the configuration for using common GCP functionality.
@@ -56,6 +407,56 @@ type Common struct {
 
 	// Logging holds the configuration for logging.
 	Logging Logging `koanf:"logging"`
+
+	// Clients holds the configuration for connect clients created with client.New,
+	// keyed by the name of the client.
+	Clients map[string]Client `koanf:"clients"`
+}
+
+// Client holds the configuration for a connect client.
+type Client struct {
+	// Address is the base URL of the server, such as "https://api.example.com".
+	Address string `koanf:"address"`
+
+	// H2C is whether to call plain "http" addresses with HTTP/2 without TLS (h2c), which
+	// the server must support. It is always used with the "grpc" protocol, which requires
+	// HTTP/2. Defaults to false, using HTTP/1.1.
+	H2C bool `koanf:"h2c"`
+
+	// Protocol is the protocol to call the server with, one of "connect", "grpc" or
+	// "grpcweb". Defaults to "connect".
+	Protocol string `koanf:"protocol"`
+
+	// Timeout is the maximum duration of unary calls. A shorter deadline on the context
+	// of a call takes precedence. Defaults to no timeout.
+	Timeout time.Duration `koanf:"timeout"`
+
+	// Retry holds the configuration for retrying failed calls.
+	Retry ClientRetry `koanf:"retry"`
+
+	// Auth is how to authenticate calls, one of "none", "google" to send a Google ID token
+	// for the default credentials, or "forward" to send the bearer token of the request
+	// being handled by the server. Defaults to "none".
+	Auth string `koanf:"auth"`
+
+	// Audience is the audience of Google ID tokens. Defaults to Address.
+	Audience string `koanf:"audience"`
+}
+
+// ClientRetry holds the configuration for retrying failed calls. Only unary calls to
+// methods declared as idempotent or without side effects are retried, and only when
+// failing with an unavailable error.
+type ClientRetry struct {
+	// MaxAttempts is the maximum number of attempts for a call, including the first.
+	// Defaults to 1, no retries.
+	MaxAttempts int `koanf:"maxAttempts"`
+
+	// InitialBackoff is the maximum delay before the first retry. The delay doubles
+	// for each retry, with random jitter. Defaults to 100ms.
+	InitialBackoff time.Duration `koanf:"initialBackoff"`
+
+	// MaxBackoff is the maximum delay between retries. Defaults to 5s.
+	MaxBackoff time.Duration `koanf:"maxBackoff"`
 }
 
 func (c *Common) GetCommon() *Common {
@@ -85,12 +486,15 @@ type CurioStack interface {
 // Config is merged in order from the following sources:
 //
 //  1. config.yaml embedded in this package. These are the curiostack defaults where applicable.
-//  2. config.yaml at the base of the repository, identified by being next to go.work, if present.
-//  3. config.yaml in the provided fs.FS if present.
-//  4. config-local.yaml in the provided fs.FS if present and CONFIG_ENV is unset (local development).
-//  5. config-nonlocal.yaml in the provided fs.FS if present and CONFIG_ENV is set.
-//  6. config-${CONFIG_ENV}.yaml in the provided fs.FS if present and CONFIG_ENV is set.
-//  7. Environment variables, where the config key is capitalized with '.' replaced with '_'.
+//  2. config-local.yaml embedded in this package if CONFIG_ENV is unset. These are the curiostack
+//     defaults for local development.
+//  3. config.yaml at the base of the repository, identified by being next to go.work, if present.
+//  4. config.yaml in the provided fs.FS if present.
+//  5. config-local.yaml in the provided fs.FS if present and CONFIG_ENV is unset (local development).
+//  6. config-nonlocal.yaml in the provided fs.FS if present and CONFIG_ENV is set.
+//  7. config-${CONFIG_ENV}.yaml in the provided fs.FS if present and CONFIG_ENV is set.
+//  8. Environment variables, where the config key is capitalized with '.' replaced with '_'.
+//     Lists are set with comma-separated values.
 func Load(conf CurioStack, confFiles fs.FS) error {
 	k := koanf.NewWithConf(koanf.Conf{
 		Delim:       ".",
@@ -102,6 +506,14 @@ func Load(conf CurioStack, confFiles fs.FS) error {
 		log.Fatalf("failed to load defaults: %v", err)
 	}
 
+	confEnv := os.Getenv("CONFIG_ENV")
+	if confEnv == "" {
+		if err := k.Load(rawbytes.Provider(defaultsLocal), yaml.Parser()); err != nil {
+			// Programming error, we are in control of the defaults.
+			log.Fatalf("failed to load local defaults: %v", err)
+		}
+	}
+
 	if goWorkDir := findGoWorkDir(); goWorkDir != "" {
 		if err := loadIfPresent(k, os.DirFS(goWorkDir), ".curiostack.yaml"); err != nil {
 			return err
@@ -113,7 +525,6 @@ func Load(conf CurioStack, confFiles fs.FS) error {
 			return err
 		}
 
-		confEnv := os.Getenv("CONFIG_ENV")
 		if confEnv == "" {
 			if err := loadIfPresent(k, confFiles, "config-local.yaml"); err != nil {
 				return err
@@ -128,9 +539,19 @@ func Load(conf CurioStack, confFiles fs.FS) error {
 		}
 	}
 
+	// Environment variables are always uppercase, so we match them against keys
+	// that have already been loaded to preserve casing of camelCase keys and the
+	// type of their values.
+	keys := k.Keys()
 	if err := k.Load(env.Provider(".", env.Opt{
-		TransformFunc: func(k, v string) (string, any) {
-			return strings.ReplaceAll(strings.ToLower(k), "_", "."), v
+		TransformFunc: func(name, v string) (string, any) {
+			key := strings.ReplaceAll(strings.ToLower(name), "_", ".")
+			for _, existing := range keys {
+				if strings.EqualFold(existing, key) {
+					return existing, envValue(k.Get(existing), v)
+				}
+			}
+			return key, v
 		},
 	}), nil); err != nil {
 		return fmt.Errorf("config: failed to load env: %w", err)
@@ -141,6 +562,12 @@ func Load(conf CurioStack, confFiles fs.FS) error {
 			Result:           conf,
 			Squash:           true,
 			WeaklyTypedInput: true,
+			DecodeHook: mapstructure.ComposeDecodeHookFunc(
+				mapstructure.StringToTimeDurationHookFunc(),
+				// Lists can only be set from environment variables as strings.
+				mapstructure.StringToSliceHookFunc(","),
+				mapstructure.TextUnmarshallerHookFunc(),
+			),
 		},
 	}); err != nil {
 		return fmt.Errorf("config: failed to unmarshal: %w", err)
@@ -149,6 +576,30 @@ func Load(conf CurioStack, confFiles fs.FS) error {
 	return nil
 }
 
+// envValue converts the value of an environment variable to the type of the value
+// already loaded for its key, since keys cannot be merged with values of a different
+// type. If the value cannot be converted, it is returned as is to fail the merge.
+func envValue(existing any, v string) any {
+	var (
+		res any
+		err error
+	)
+	switch existing.(type) {
+	case bool:
+		res, err = strconv.ParseBool(v)
+	case int:
+		res, err = strconv.Atoi(v)
+	case float64:
+		res, err = strconv.ParseFloat(v, 64)
+	default:
+		return v
+	}
+	if err != nil {
+		return v
+	}
+	return res
+}
+
 func loadIfPresent(k *koanf.Koanf, confFiles fs.FS, name string) error {
 	if _, err := fs.Stat(confFiles, name); err != nil {
 		if os.IsNotExist(err) {
@@ -4,6 +4,7 @@ import (
 	"io/fs"
 	"testing"
 	"testing/fstest"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -20,7 +21,10 @@ func TestLoadDefaults(t *testing.T) {
 		fs   fs.FS
 		env  map[string]string
 
-		address string
+		address         string
+		drainTimeout    time.Duration
+		maxRequestBytes ByteSize
+		openAPIOutput   string
 	}{
 		{
 			name:    "no config files",
@@ -61,6 +65,27 @@ func TestLoadDefaults(t *testing.T) {
 			env:     map[string]string{"CONFIG_ENV": "prod", "SERVER_ADDRESS": ":env"},
 			address: ":env",
 		},
+		{
+			name:            "env override of byte size",
+			fs:              allfiles.FS,
+			env:             map[string]string{"SERVER_MAXREQUESTBYTES": "1KiB"},
+			address:         ":local",
+			maxRequestBytes: 1024,
+		},
+		{
+			name:         "env override of camelCase key",
+			fs:           allfiles.FS,
+			env:          map[string]string{"SERVER_DRAINTIMEOUT": "30s"},
+			address:      ":local",
+			drainTimeout: 30 * time.Second,
+		},
+		{
+			name:          "env override of nested key",
+			fs:            allfiles.FS,
+			env:           map[string]string{"SERVER_OPENAPI_OUTPUTFILE": "openapi.json"},
+			address:       ":local",
+			openAPIOutput: "openapi.json",
+		},
 	}
 
 	for _, tc := range tests {
@@ -73,9 +98,178 @@ func TestLoadDefaults(t *testing.T) {
 
 			require.NoError(t, Load(&conf, tc.fs))
 			require.Equal(t, tc.address, conf.Server.Address)
+			drainTimeout := tc.drainTimeout
+			if drainTimeout == 0 {
+				drainTimeout = 10 * time.Second
+			}
+			require.Equal(t, drainTimeout, conf.Server.DrainTimeout)
+			maxRequestBytes := tc.maxRequestBytes
+			if maxRequestBytes == 0 {
+				maxRequestBytes = 4 * 1024 * 1024
+			}
+			require.Equal(t, maxRequestBytes, conf.Server.MaxRequestBytes)
+			require.Equal(t, 30*time.Second, conf.Server.Timeouts.Default)
+			if tc.env["CONFIG_ENV"] == "" {
+				require.Zero(t, conf.Server.ShutdownDelay)
+			} else {
+				require.Equal(t, 5*time.Second, conf.Server.ShutdownDelay)
+			}
+			require.Equal(t, "1.0.0", conf.Server.OpenAPI.Version)
+			require.Equal(t, "X-API-Key", conf.Server.DocsAuth.APIKeyHeader)
+			require.Equal(t, tc.openAPIOutput, conf.Server.OpenAPI.OutputFile)
+
+			// Local defaults only apply when CONFIG_ENV is unset.
+			require.Equal(t, tc.env["CONFIG_ENV"] == "", conf.Server.EnableReflection)
+			require.Equal(t, tc.env["CONFIG_ENV"] == "", conf.Server.ValidateResponses)
 
 			// From repo root
 			require.Equal(t, "curioswitch-dev", conf.Google.Project)
 		})
 	}
 }
+
+type typedConfig struct {
+	Common
+
+	Feature struct {
+		Enabled  bool    `koanf:"enabled"`
+		Replicas int     `koanf:"replicas"`
+		Ratio    float64 `koanf:"ratio"`
+	} `koanf:"feature"`
+}
+
+func TestLoadEnvTypes(t *testing.T) {
+	files := fstest.MapFS{
+		"config.yaml": {Data: []byte("feature:\n  enabled: false\n  replicas: 1\n  ratio: 0.5\n")},
+	}
+
+	tests := []struct {
+		name string
+		env  map[string]string
+
+		check func(t *testing.T, conf *typedConfig)
+		err   bool
+	}{
+		{
+			name: "bool",
+			env:  map[string]string{"FEATURE_ENABLED": "true"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.True(t, conf.Feature.Enabled)
+			},
+		},
+		{
+			name: "int",
+			env:  map[string]string{"FEATURE_REPLICAS": "3"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.Equal(t, 3, conf.Feature.Replicas)
+			},
+		},
+		{
+			name: "float",
+			env:  map[string]string{"FEATURE_RATIO": "0.25"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.InDelta(t, 0.25, conf.Feature.Ratio, 0)
+			},
+		},
+		{
+			name: "enable reflection",
+			env:  map[string]string{"CONFIG_ENV": "prod", "SERVER_ENABLEREFLECTION": "true"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.True(t, conf.Server.EnableReflection)
+			},
+		},
+		{
+			name: "validate responses",
+			env:  map[string]string{"CONFIG_ENV": "prod", "SERVER_VALIDATERESPONSES": "true"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.True(t, conf.Server.ValidateResponses)
+			},
+		},
+		{
+			name: "disable local response validation",
+			env:  map[string]string{"SERVER_VALIDATERESPONSES": "false"},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.False(t, conf.Server.ValidateResponses)
+			},
+		},
+		{
+			name: "internal",
+			env: map[string]string{
+				"SERVER_INTERNAL_DISABLEDOCS":     "true",
+				"SERVER_INTERNAL_ALLOWEDIPS":      "10.0.0.0/8,192.168.0.0/16",
+				"SERVER_INTERNAL_TRUSTEDPROXIES":  "1",
+				"SERVER_INTERNAL_REQUIREIDENTITY": "true",
+				"SERVER_INTERNAL_LOGACCESS":       "true",
+			},
+			check: func(t *testing.T, conf *typedConfig) {
+				t.Helper()
+				require.Equal(t, Internal{
+					DisableDocs:     true,
+					AllowedIPs:      []string{"10.0.0.0/8", "192.168.0.0/16"},
+					TrustedProxies:  1,
+					RequireIdentity: true,
+					LogAccess:       true,
+				}, conf.Server.Internal)
+			},
+		},
+		{
+			name: "invalid bool",
+			env:  map[string]string{"FEATURE_ENABLED": "sometimes"},
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			for k, v := range tc.env {
+				t.Setenv(k, v)
+			}
+
+			var conf typedConfig
+			err := Load(&conf, files)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			tc.check(t, &conf)
+		})
+	}
+}
+
+func TestByteSize(t *testing.T) {
+	tests := []struct {
+		text string
+
+		size ByteSize
+		err  bool
+	}{
+		{text: "1024", size: 1024},
+		{text: "10B", size: 10},
+		{text: "512KB", size: 512 * 1000},
+		{text: "4MiB", size: 4 * 1024 * 1024},
+		{text: "1.5 GiB", size: 1536 * 1024 * 1024},
+		{text: "2mb", size: 2 * 1000 * 1000},
+		{text: "4XB", err: true},
+		{text: "MiB", err: true},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.text, func(t *testing.T) {
+			var size ByteSize
+			err := size.UnmarshalText([]byte(tc.text))
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.size, size)
+		})
+	}
+}
@@ -24,7 +24,7 @@ func HTTPMiddleware() func(http.Handler) http.Handler {
 		otelhttp.WithMeterProvider(meterProvider),
 		otelhttp.WithTracerProvider(tracerProvider),
 		otelhttp.WithFilter(func(r *http.Request) bool {
-			return !strings.HasPrefix(r.URL.Path, "/internal/")
+			return !strings.HasPrefix(r.URL.Path, "/internal/") && !strings.HasPrefix(r.URL.Path, "/grpc.health.v1.Health/")
 		}),
 	}
 
@@ -59,3 +59,17 @@ func ConnectInterceptor() connect.Interceptor {
 	}
 	return i
 }
+
+// ConnectClientInterceptor returns a connect.Interceptor for clients configured
+// with tracing and metrics.
+func ConnectClientInterceptor() connect.Interceptor {
+	Initialize()
+	i, err := otelconnect.NewInterceptor(
+		otelconnect.WithMeterProvider(meterProvider),
+		otelconnect.WithTracerProvider(tracerProvider),
+	)
+	if err != nil {
+		log.Fatalf("failed to create connect client interceptor: %v\n", err)
+	}
+	return i
+}
@@ -16,6 +16,7 @@ import (
 	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
 	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
 	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/metric"
 	"go.opentelemetry.io/otel/propagation"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -39,6 +40,13 @@ func Initialize() {
 	initOnce.Do(doInitialize)
 }
 
+// Meter returns a metric.Meter from the configured meter provider for recording
+// metrics of the given instrumentation scope.
+func Meter(name string) metric.Meter {
+	Initialize()
+	return meterProvider.Meter(name)
+}
+
 func doInitialize() {
 	ctx := context.Background()
 
@@ -0,0 +1,199 @@
+package rpcerr
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Sentinel errors for each code. They can be returned directly or wrapped, e.g. with
+// fmt.Errorf("book %s: %w", id, rpcerr.ErrNotFound), in which case only the code is
+// returned to the client. Use New or Wrap to also return a message or details.
+//
+// Any Error with the same code matches these with errors.Is.
+var (
+	ErrCanceled           = sentinel(connect.CodeCanceled)
+	ErrUnknown            = sentinel(connect.CodeUnknown)
+	ErrInvalidArgument    = sentinel(connect.CodeInvalidArgument)
+	ErrDeadlineExceeded   = sentinel(connect.CodeDeadlineExceeded)
+	ErrNotFound           = sentinel(connect.CodeNotFound)
+	ErrAlreadyExists      = sentinel(connect.CodeAlreadyExists)
+	ErrPermissionDenied   = sentinel(connect.CodePermissionDenied)
+	ErrResourceExhausted  = sentinel(connect.CodeResourceExhausted)
+	ErrFailedPrecondition = sentinel(connect.CodeFailedPrecondition)
+	ErrAborted            = sentinel(connect.CodeAborted)
+	ErrOutOfRange         = sentinel(connect.CodeOutOfRange)
+	ErrUnimplemented      = sentinel(connect.CodeUnimplemented)
+	ErrInternal           = sentinel(connect.CodeInternal)
+	ErrUnavailable        = sentinel(connect.CodeUnavailable)
+	ErrDataLoss           = sentinel(connect.CodeDataLoss)
+	ErrUnauthenticated    = sentinel(connect.CodeUnauthenticated)
+)
+
+// Error is an error with a code, and optionally a message and details, to return to
+// clients. The cause of an Error is only logged, never returned to clients.
+type Error struct {
+	code     connect.Code
+	message  string
+	cause    error
+	details  []proto.Message
+	sentinel bool
+}
+
+// New returns an Error with the code and a message to return to the client.
+func New(code connect.Code, message string) *Error {
+	return &Error{code: code, message: message}
+}
+
+// Wrap returns an Error with the code and a message to return to the client, caused
+// by err. err is logged but not returned to the client.
+func Wrap(err error, code connect.Code, message string) *Error {
+	return &Error{code: code, message: message, cause: err}
+}
+
+// Code returns the code of the error.
+func (e *Error) Code() connect.Code {
+	return e.code
+}
+
+// Message returns the message of the error returned to clients.
+func (e *Error) Message() string {
+	return e.message
+}
+
+// Details returns the details of the error returned to clients.
+func (e *Error) Details() []proto.Message {
+	return e.details
+}
+
+// WithDetails returns a copy of the error with details added.
+func (e *Error) WithDetails(details ...proto.Message) *Error {
+	res := *e
+	res.sentinel = false
+	res.details = append(slices.Clip(e.details), details...)
+	return &res
+}
+
+// WithErrorInfo returns a copy of the error with a google.rpc.ErrorInfo detail, which
+// identifies the cause of the error in a machine-readable way. reason is a constant in
+// UPPER_SNAKE_CASE, and domain is generally the name of the service.
+func (e *Error) WithErrorInfo(reason string, domain string, metadata map[string]string) *Error {
+	return e.WithDetails(&errdetails.ErrorInfo{
+		Reason:   reason,
+		Domain:   domain,
+		Metadata: maps.Clone(metadata),
+	})
+}
+
+// WithRetryInfo returns a copy of the error with a google.rpc.RetryInfo detail, telling
+// clients to wait for delay before retrying.
+func (e *Error) WithRetryInfo(delay time.Duration) *Error {
+	return e.WithDetails(&errdetails.RetryInfo{
+		RetryDelay: durationpb.New(delay),
+	})
+}
+
+func (e *Error) Error() string {
+	msg := e.message
+	if msg == "" {
+		msg = e.code.String()
+	}
+	if e.cause != nil {
+		return msg + ": " + e.cause.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.cause
+}
+
+// Is returns whether target is the sentinel error for the code of e.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.sentinel && t.code == e.code
+}
+
+func sentinel(code connect.Code) *Error {
+	return &Error{code: code, sentinel: true}
+}
+
+// ToConnectError converts an error returned by a handler to a connect error to return
+// to the client.
+//
+//   - A *connect.Error returned as-is is passed through unchanged, so handlers can still
+//     fully control responses. The exception is connect.CodeInternal and
+//     connect.CodeUnknown, which are returned without a message, metadata or details
+//     as they generally wrap internal errors.
+//   - An Error, possibly wrapped, is converted with its code, message and details.
+//   - context.Canceled and context.DeadlineExceeded are converted to their codes.
+//   - Any other error, including a wrapped *connect.Error such as one returned by a
+//     connect client, is converted to connect.CodeInternal without a message, to avoid
+//     leaking internal information to clients.
+//
+// The original error can be retrieved from the result with Cause for logging.
+func ToConnectError(err error) *connect.Error {
+	if err == nil {
+		return nil
+	}
+
+	if cerr, ok := err.(*connect.Error); ok { //nolint:errorlint // only unwrapped connect errors are passed through
+		switch cerr.Code() {
+		case connect.CodeInternal, connect.CodeUnknown:
+			return connect.NewError(cerr.Code(), &publicError{cause: err})
+		default:
+			return cerr
+		}
+	}
+
+	var e *Error
+	switch {
+	case errors.As(err, &e):
+	case errors.Is(err, context.Canceled):
+		e = ErrCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		e = ErrDeadlineExceeded
+	default:
+		e = ErrInternal
+	}
+
+	res := connect.NewError(e.code, &publicError{message: e.message, cause: err})
+	for _, d := range e.details {
+		if detail, err := connect.NewErrorDetail(d); err == nil {
+			res.AddDetail(detail)
+		}
+	}
+	return res
+}
+
+// Cause returns the error a connect error was converted from by ToConnectError, or
+// err itself if it was not converted.
+func Cause(err error) error {
+	var p *publicError
+	if errors.As(err, &p) {
+		return p.cause
+	}
+	return err
+}
+
+// publicError is the message of a converted connect error, wrapping the original
+// error which is not returned to clients.
+type publicError struct {
+	message string
+	cause   error
+}
+
+func (e *publicError) Error() string {
+	return e.message
+}
+
+func (e *publicError) Unwrap() error {
+	return e.cause
+}
@@ -0,0 +1,135 @@
+package rpcerr
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+)
+
+var errDatabase = errors.New("connection refused to 10.0.0.1")
+
+func TestToConnectError(t *testing.T) {
+	explicit := connect.NewError(connect.CodeAborted, errors.New("book was modified"))
+	backend := connect.NewError(connect.CodeUnavailable, errDatabase)
+	backend.Meta().Set("X-Backend-Host", "10.0.0.1")
+
+	tests := []struct {
+		name string
+		err  error
+
+		code    connect.Code
+		message string
+		details []proto.Message
+	}{
+		{
+			name:    "plain error",
+			err:     errDatabase,
+			code:    connect.CodeInternal,
+			message: "",
+		},
+		{
+			name:    "sentinel",
+			err:     ErrNotFound,
+			code:    connect.CodeNotFound,
+			message: "",
+		},
+		{
+			name:    "wrapped sentinel",
+			err:     fmt.Errorf("book %s: %w", "1", ErrNotFound),
+			code:    connect.CodeNotFound,
+			message: "",
+		},
+		{
+			name:    "new",
+			err:     New(connect.CodeAlreadyExists, "book already exists"),
+			code:    connect.CodeAlreadyExists,
+			message: "book already exists",
+		},
+		{
+			name:    "wrap",
+			err:     fmt.Errorf("saving book: %w", Wrap(errDatabase, connect.CodeUnavailable, "try again later").WithRetryInfo(time.Second)),
+			code:    connect.CodeUnavailable,
+			message: "try again later",
+			details: []proto.Message{&errdetails.RetryInfo{}},
+		},
+		{
+			name:    "error info",
+			err:     ErrPermissionDenied.WithErrorInfo("NOT_OWNER", "books.example.com", map[string]string{"book": "1"}),
+			code:    connect.CodePermissionDenied,
+			message: "",
+			details: []proto.Message{&errdetails.ErrorInfo{}},
+		},
+		{
+			name:    "canceled",
+			err:     fmt.Errorf("querying: %w", context.Canceled),
+			code:    connect.CodeCanceled,
+			message: "",
+		},
+		{
+			name:    "deadline exceeded",
+			err:     fmt.Errorf("querying: %w", context.DeadlineExceeded),
+			code:    connect.CodeDeadlineExceeded,
+			message: "",
+		},
+		{
+			name:    "connect error",
+			err:     explicit,
+			code:    connect.CodeAborted,
+			message: "book was modified",
+		},
+		{
+			name:    "internal connect error",
+			err:     connect.NewError(connect.CodeInternal, errDatabase),
+			code:    connect.CodeInternal,
+			message: "",
+		},
+		{
+			name:    "unknown connect error",
+			err:     connect.NewError(connect.CodeUnknown, errDatabase),
+			code:    connect.CodeUnknown,
+			message: "",
+		},
+		{
+			name:    "wrapped connect error",
+			err:     fmt.Errorf("calling backend: %w", backend),
+			code:    connect.CodeInternal,
+			message: "",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cerr := ToConnectError(tc.err)
+			require.Equal(t, tc.code, cerr.Code())
+			require.Equal(t, tc.message, cerr.Message())
+			require.NotContains(t, cerr.Error(), "10.0.0.1")
+			require.Empty(t, cerr.Meta())
+			require.ErrorIs(t, Cause(cerr), tc.err)
+			require.Len(t, cerr.Details(), len(tc.details))
+			for i, d := range cerr.Details() {
+				v, err := d.Value()
+				require.NoError(t, err)
+				require.IsType(t, tc.details[i], v)
+			}
+		})
+	}
+
+	require.Nil(t, ToConnectError(nil))
+}
+
+func TestErrorIs(t *testing.T) {
+	err := Wrap(errDatabase, connect.CodeNotFound, "book not found").WithErrorInfo("MISSING", "books.example.com", nil)
+	require.ErrorIs(t, err, ErrNotFound)
+	require.ErrorIs(t, err, errDatabase)
+	require.NotErrorIs(t, err, ErrInternal)
+	require.NotErrorIs(t, ErrNotFound, err)
+	require.Equal(t, "book not found: connection refused to 10.0.0.1", err.Error())
+	require.Equal(t, "not_found", ErrNotFound.Error())
+}
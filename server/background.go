@@ -0,0 +1,149 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+var (
+	errWorkerPanicked   = errors.New("background worker panicked")
+	errWorkerNotStarted = errors.New("background worker has not started")
+)
+
+// BackgroundOption is a configuration option for RunBackground.
+type BackgroundOption interface {
+	apply(w *backgroundWorker)
+}
+
+// Critical returns a BackgroundOption to indicate the worker is critical to the server.
+// If a critical worker returns an error, the server is shut down and Main returns a
+// non-zero exit code.
+func Critical() BackgroundOption {
+	return criticalOption{}
+}
+
+type criticalOption struct{}
+
+func (criticalOption) apply(w *backgroundWorker) {
+	w.critical = true
+}
+
+// RunBackground registers a worker to run in the background for the lifetime of the
+// server, such as a queue consumer or cache refresher. Workers are started by Start
+// after OnStart hooks and the context passed to run is cancelled after the server has
+// drained requests, before OnShutdown hooks are run. run should block until ctx is done
+// and return nil on cancellation.
+//
+// The status of each worker is reported in the readiness health check under the name
+// "background/<name>". Only failures of critical workers cause the server to be reported
+// as not ready.
+func RunBackground(s *Server, name string, run func(ctx context.Context) error, opts ...BackgroundOption) {
+	w := &backgroundWorker{
+		name: name,
+		run:  run,
+		err:  errWorkerNotStarted,
+	}
+	for _, o := range opts {
+		o.apply(w)
+	}
+	s.workers = append(s.workers, w)
+	s.health.checks = append(s.health.checks, healthCheck{
+		name:     "background/" + name,
+		check:    w.healthCheck,
+		optional: !w.critical,
+	})
+}
+
+type backgroundWorker struct {
+	name     string
+	run      func(ctx context.Context) error
+	critical bool
+
+	mu  sync.Mutex
+	err error
+}
+
+func (w *backgroundWorker) healthCheck(context.Context) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *backgroundWorker) setErr(err error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.err = err
+}
+
+// start runs the worker until it returns, returning an error if it failed.
+func (w *backgroundWorker) start(ctx context.Context) (err error) {
+	w.setErr(nil)
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("%w: %v", errWorkerPanicked, p)
+		}
+		if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+			// Returning the cancellation error is a normal way of stopping.
+			err = nil
+		}
+		w.setErr(err)
+	}()
+	return w.run(ctx)
+}
+
+// backgroundWorkers tracks running background workers.
+type backgroundWorkers struct {
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// failed receives errors from critical workers.
+	failed chan error
+}
+
+// startWorkers starts all registered background workers.
+func (b *Server) startWorkers(ctx context.Context) *backgroundWorkers {
+	ctx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	workers := &backgroundWorkers{
+		cancel: cancel,
+		failed: make(chan error, len(b.workers)),
+	}
+
+	for _, w := range b.workers {
+		workers.wg.Go(func() {
+			err := w.start(ctx)
+			switch {
+			case err == nil:
+				if ctx.Err() == nil {
+					slog.InfoContext(ctx, fmt.Sprintf("Background worker %s finished", w.name))
+				}
+			case w.critical:
+				workers.failed <- fmt.Errorf("server: critical background worker %s failed: %w", w.name, err)
+			default:
+				slog.ErrorContext(ctx, fmt.Sprintf("Background worker %s failed", w.name), "error", err)
+			}
+		})
+	}
+
+	return workers
+}
+
+// stop cancels all workers and waits up to timeout for them to return.
+func (w *backgroundWorkers) stop(ctx context.Context, timeout time.Duration) {
+	w.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		w.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(timeout):
+		slog.WarnContext(ctx, fmt.Sprintf("Background workers did not stop within %v", timeout))
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errWorkerFailed = errors.New("worker failed")
+
+func TestRunBackground(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+	s.conf.Server.Health.CacheDuration = 0
+
+	stopped := make(chan struct{})
+	RunBackground(s, "consumer", func(ctx context.Context) error {
+		<-ctx.Done()
+		close(stopped)
+		return ctx.Err()
+	}, Critical())
+	RunBackground(s, "flaky", func(context.Context) error {
+		return errWorkerFailed
+	})
+	shutdownSawStopped := false
+	OnShutdown(s, "check", func(context.Context) error {
+		select {
+		case <-stopped:
+			shutdownSawStopped = true
+		default:
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- Start(ctx, s)
+	}()
+
+	url := "http://" + s.conf.Server.Address + "/internal/health/ready"
+	waitForServer(t, url)
+
+	// The failing worker is not critical so is reported without affecting readiness.
+	require.Eventually(t, func() bool {
+		res, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		defer res.Body.Close()
+		var report healthReport
+		if err := json.NewDecoder(res.Body).Decode(&report); err != nil {
+			return false
+		}
+		return res.StatusCode == http.StatusOK &&
+			report.Checks["background/flaky"].Error == errWorkerFailed.Error() &&
+			report.Checks["background/consumer"].Status == healthStatusServing
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	require.NoError(t, <-startErr)
+	require.True(t, shutdownSawStopped)
+}
+
+func TestRunBackgroundCriticalFails(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+
+	RunBackground(s, "consumer", func(context.Context) error {
+		return errWorkerFailed
+	}, Critical())
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Start(t.Context(), s)
+	}()
+
+	select {
+	case err := <-errc:
+		require.ErrorIs(t, err, errWorkerFailed)
+		require.ErrorContains(t, err, `critical background worker consumer failed`)
+		require.True(t, s.serving)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestRunBackgroundPanics(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+
+	RunBackground(s, "consumer", func(context.Context) error {
+		panic("boom")
+	}, Critical())
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- Start(t.Context(), s)
+	}()
+
+	select {
+	case err := <-errc:
+		require.ErrorIs(t, err, errWorkerPanicked)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
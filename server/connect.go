@@ -3,20 +3,39 @@ package server
 import (
 	"context"
 	"log/slog"
+	"net/http"
+	"slices"
 	"strings"
 
 	"connectrpc.com/connect"
 	"github.com/curioswitch/go-usegcp/middleware/requestlog"
+	"github.com/go-chi/chi/v5"
 	"google.golang.org/protobuf/proto"
 	"google.golang.org/protobuf/reflect/protoreflect"
 	"google.golang.org/protobuf/reflect/protoregistry"
 
 	"github.com/curioswitch/go-curiostack/otel"
+	"github.com/curioswitch/go-curiostack/rpcerr"
 )
 
 // HandleConnectUnary mounts a connect unary handler for the given procedure with the
 // given handler. Sample requests will be displayed in the docs interface and is recommended
-// to be provided whenever possible.
+// to be provided whenever possible. Procedures are listed in the docs interface even
+// without sample requests.
+//
+// The request, including authentication and validation, is bounded by the timeout for
+// the procedure in config.Timeouts, or the deadline set by the client if shorter. The
+// handler's context is canceled when the deadline passes and the request fails with a
+// deadline exceeded error. Streaming procedures are not bounded by config.Timeouts.
+//
+// If the method declares a curiostack.auth.v1.policy option, it is enforced for requests
+// authenticated with JWTs from the issuers in config.Auth. Otherwise, if any issuers are
+// configured, requests must be authenticated with a token from one of them.
+//
+// If the method has google.api.http annotations, REST routes are also mounted which
+// transcode requests to the procedure. Path variables and query parameters are mapped to
+// request fields, the HTTP body to the request or the field specified by the annotation,
+// and the response is returned as JSON.
 func HandleConnectUnary[Req any, Resp any](
 	s *Server,
 	procedure string,
@@ -24,6 +43,110 @@ func HandleConnectUnary[Req any, Resp any](
 	sampleRequests []*Req,
 	opts ...connect.HandlerOption,
 ) {
+	svc, method := resolveProcedure[Req, Resp](procedure)
+	if method.IsStreamingClient() || method.IsStreamingServer() {
+		panic("procedure must be a unary method, use the streaming variants of HandleConnect for streaming methods")
+	}
+
+	opts = handlerOptions(s, method, opts)
+	h := connect.NewUnaryHandler(
+		procedure,
+		func(ctx context.Context, r *connect.Request[Req]) (*connect.Response[Resp], error) {
+			resp, err := handler(ctx, r.Msg)
+			if err != nil {
+				return nil, err
+			}
+			return connect.NewResponse(resp), nil
+		},
+		connect.WithSchema(svc),
+		connect.WithHandlerOptions(opts...),
+	)
+	mountProcedure(s, procedure, h)
+	mountRESTRoutes(s, procedure, method, h, opts)
+
+	registerProcedure(s, procedure, sampleRequests)
+}
+
+// HandleConnectServerStream mounts a connect server streaming handler for the given procedure
+// with the given handler. Sample requests will be displayed in the docs interface and is
+// recommended to be provided whenever possible.
+func HandleConnectServerStream[Req any, Resp any](
+	s *Server,
+	procedure string,
+	handler func(ctx context.Context, req *Req, stream *connect.ServerStream[Resp]) error,
+	sampleRequests []*Req,
+	opts ...connect.HandlerOption,
+) {
+	svc, method := resolveProcedure[Req, Resp](procedure)
+	if method.IsStreamingClient() || !method.IsStreamingServer() {
+		panic("procedure must be a server streaming method")
+	}
+
+	opts = handlerOptions(s, method, opts)
+	h := connect.NewServerStreamHandlerSimple(
+		procedure,
+		handler,
+		connect.WithSchema(svc),
+		connect.WithHandlerOptions(opts...),
+	)
+	mountProcedure(s, procedure, h)
+
+	registerProcedure(s, procedure, sampleRequests)
+}
+
+// HandleConnectClientStream mounts a connect client streaming handler for the given procedure
+// with the given handler.
+func HandleConnectClientStream[Req any, Resp any](
+	s *Server,
+	procedure string,
+	handler func(ctx context.Context, stream *connect.ClientStream[Req]) (*Resp, error),
+	opts ...connect.HandlerOption,
+) {
+	svc, method := resolveProcedure[Req, Resp](procedure)
+	if !method.IsStreamingClient() || method.IsStreamingServer() {
+		panic("procedure must be a client streaming method")
+	}
+
+	opts = handlerOptions(s, method, opts)
+	h := connect.NewClientStreamHandlerSimple(
+		procedure,
+		handler,
+		connect.WithSchema(svc),
+		connect.WithHandlerOptions(opts...),
+	)
+	mountProcedure(s, procedure, h)
+
+	registerProcedure[Req](s, procedure, nil)
+}
+
+// HandleConnectBidiStream mounts a connect bidirectional streaming handler for the given
+// procedure with the given handler.
+func HandleConnectBidiStream[Req any, Resp any](
+	s *Server,
+	procedure string,
+	handler func(ctx context.Context, stream *connect.BidiStream[Req, Resp]) error,
+	opts ...connect.HandlerOption,
+) {
+	svc, method := resolveProcedure[Req, Resp](procedure)
+	if !method.IsStreamingClient() || !method.IsStreamingServer() {
+		panic("procedure must be a bidirectional streaming method")
+	}
+
+	opts = handlerOptions(s, method, opts)
+	h := connect.NewBidiStreamHandler(
+		procedure,
+		handler,
+		connect.WithSchema(svc),
+		connect.WithHandlerOptions(opts...),
+	)
+	mountProcedure(s, procedure, h)
+
+	registerProcedure[Req](s, procedure, nil)
+}
+
+// resolveProcedure finds the service and method descriptors for the procedure, verifying
+// that the request and response types match the method.
+func resolveProcedure[Req any, Resp any](procedure string) (protoreflect.ServiceDescriptor, protoreflect.MethodDescriptor) {
 	p, ok := strings.CutPrefix(procedure, "/")
 	if !ok {
 		panic("procedure must be a constant from connect generated code, such as curioapi.CurioServiceMethodProcedure")
@@ -58,20 +181,57 @@ func HandleConnectUnary[Req any, Resp any](
 		panic("response type must match the output type of the procedure in the proto")
 	}
 
-	opts = append(ConnectHandlerOptions(), opts...)
-	h := connect.NewUnaryHandler(
-		procedure,
-		func(ctx context.Context, r *connect.Request[Req]) (*connect.Response[Resp], error) {
-			resp, err := handler(ctx, r.Msg)
-			if err != nil {
-				return nil, err
-			}
-			return connect.NewResponse(resp), nil
-		},
-		connect.WithSchema(svc),
-		connect.WithHandlerOptions(opts...),
-	)
-	s.mux.Handle(procedure, h)
+	return svcDesc, method
+}
+
+// ReadMaxBytes returns a connect.HandlerOption to limit the size of each request message
+// for a procedure to maxBytes, overriding the server-wide config.Server.MaxRequestBytes. It
+// can be used both to allow larger requests, such as for uploads, or to further restrict
+// public endpoints. For REST routes transcoded from google.api.http annotations, it also
+// limits the size of the HTTP body, so it must be passed directly to a HandleConnect
+// function, not nested in [connect.WithHandlerOptions].
+func ReadMaxBytes(maxBytes int) connect.HandlerOption {
+	return &readMaxBytesOption{
+		HandlerOption: connect.WithReadMaxBytes(maxBytes),
+		maxBytes:      maxBytes,
+	}
+}
+
+// readMaxBytesOption is a connect.HandlerOption that also allows HandleConnect functions
+// to apply the limit to the HTTP body of transcoded REST routes.
+type readMaxBytesOption struct {
+	connect.HandlerOption
+
+	maxBytes int
+}
+
+// mountProcedure mounts the handler for the procedure. The limit on the size of the HTTP
+// body is removed, since connect limits the size of each message instead, so streams are
+// not limited in total.
+func mountProcedure(s *Server, procedure string, h http.Handler) {
+	s.mux.With(overrideRequestBodyLimit(0)).Handle(procedure, h)
+}
+
+// procedureMiddlewares returns the HTTP middleware required by server-specific handler
+// options for routes other than the connect procedure.
+func procedureMiddlewares(opts []connect.HandlerOption) chi.Middlewares {
+	var middlewares chi.Middlewares
+	for _, o := range opts {
+		if o, ok := o.(*readMaxBytesOption); ok {
+			middlewares = append(middlewares, overrideRequestBodyLimit(int64(o.maxBytes)))
+		}
+	}
+	return middlewares
+}
+
+// registerProcedure records the procedure and its service for the docs handler along
+// with any sample requests.
+func registerProcedure[Req any](s *Server, procedure string, sampleRequests []*Req) {
+	s.procedures = append(s.procedures, procedure)
+	svc, _, _ := strings.Cut(procedure[1:], "/")
+	if !slices.Contains(s.services, svc) {
+		s.services = append(s.services, svc)
+	}
 
 	if len(sampleRequests) > 0 {
 		sampleReqs := make([]proto.Message, len(sampleRequests))
@@ -80,11 +240,23 @@ func HandleConnectUnary[Req any, Resp any](
 			// type cast works.
 			sampleReqs[i] = any(r).(proto.Message) //nolint:forcetypeassert
 		}
-		s.protoDocsRequests = append(s.protoDocsRequests, protoDocsRequests{
-			procedure: procedure,
-			reqs:      sampleReqs,
-		})
+		s.addProtoDocsRequests(procedure, sampleReqs)
+	}
+}
+
+// addProtoDocsRequests adds sample requests for the procedure to the docs handler,
+// after any already added for it.
+func (b *Server) addProtoDocsRequests(procedure string, reqs []proto.Message) {
+	for i := range b.protoDocsRequests {
+		if b.protoDocsRequests[i].procedure == procedure {
+			b.protoDocsRequests[i].reqs = append(b.protoDocsRequests[i].reqs, reqs...)
+			return
+		}
 	}
+	b.protoDocsRequests = append(b.protoDocsRequests, protoDocsRequests{
+		procedure: procedure,
+		reqs:      reqs,
+	})
 }
 
 func checkMatchesType(p any, desc protoreflect.Descriptor) bool {
@@ -94,37 +266,135 @@ func checkMatchesType(p any, desc protoreflect.Descriptor) bool {
 	return false
 }
 
-// ConnectHandlerOptions returns the default options for connect handlers.
+// handlerOptions returns the options for a connect handler for method registered on s,
+// the defaults followed by server-specific options and then opts.
+func handlerOptions(s *Server, method protoreflect.MethodDescriptor, opts []connect.HandlerOption) []connect.HandlerOption {
+	policy := methodAuthPolicy(method)
+
+	firebaseAuth := &firebaseAuthInterceptor{s: s, exempt: policy.GetPublic()}
+	for _, o := range opts {
+		if _, ok := o.(*skipFirebaseAuthOption); ok {
+			firebaseAuth.exempt = true
+		}
+	}
+	jwtAuth := &jwtAuthInterceptor{s: s, policy: policy}
+
+	// Streaming procedures are not bounded, which the interceptor handles by passing
+	// them through.
+	procedure := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+	timeout := &timeoutInterceptor{timeout: procedureTimeout(&s.conf.Server.Timeouts, procedure)}
+
+	res := connectHandlerOptions(timeout, jwtAuth, firebaseAuth)
+	if s.conf.Server.ValidateResponses {
+		res = append(res, connect.WithInterceptors(&validateInterceptor{responses: true}))
+	}
+	if maxBytes := s.conf.Server.MaxRequestBytes; maxBytes > 0 {
+		// Before opts so ReadMaxBytes overrides it.
+		res = append(res, connect.WithReadMaxBytes(int(maxBytes)))
+	}
+	return append(res, opts...)
+}
+
+// ConnectHandlerOptions returns the default options for connect handlers. Request
+// messages are validated against the buf.validate constraints declared in their protos,
+// failing with an invalid argument error with BadRequest details when invalid. Panics
+// in handlers are recovered and logged, failing with an internal error.
+//
+// Errors returned by handlers are converted with rpcerr.ToConnectError, so only the
+// code, message and details of an rpcerr.Error are returned to clients while the full
+// error is logged. Other errors fail with an internal error without a message.
 func ConnectHandlerOptions() []connect.HandlerOption {
-	return []connect.HandlerOption{
-		connect.WithInterceptors(rpcLogger(), otel.ConnectInterceptor()),
+	return connectHandlerOptions()
+}
+
+// connectHandlerOptions returns ConnectHandlerOptions with the inner interceptors, such
+// as timeouts and auth, run after recovering panics and before requests are validated,
+// so unauthenticated callers cannot probe validation.
+func connectHandlerOptions(inner ...connect.Interceptor) []connect.HandlerOption {
+	interceptors := []connect.Interceptor{
+		rpcLogger(),
+		otel.ConnectInterceptor(),
+		&errorInterceptor{},
+		&recoverInterceptor{},
 	}
+	interceptors = append(interceptors, inner...)
+	interceptors = append(interceptors, &validateInterceptor{})
+	return []connect.HandlerOption{connect.WithInterceptors(interceptors...)}
 }
 
 func rpcLogger() connect.Interceptor {
-	return connect.UnaryInterceptorFunc(func(next connect.UnaryFunc) connect.UnaryFunc {
-		return func(ctx context.Context, req connect.AnyRequest) (res connect.AnyResponse, err error) {
-			svc, method := parseFullMethod(req.Spec().Procedure)
-			requestlog.AddExtraAttr(ctx, slog.String("rpc.service", svc))
-			requestlog.AddExtraAttr(ctx, slog.String("rpc.method", method))
-
-			defer func() {
-				grpcCode := 0
-				if p := recover(); p != nil {
-					defer panic(p)
-					grpcCode = int(connect.CodeUnknown)
-				} else if err != nil {
-					grpcCode = int(connect.CodeOf(err))
-					requestlog.AddExtraAttr(ctx, slog.String("error", err.Error()))
-				}
-
-				requestlog.AddExtraAttr(ctx, slog.Int("rpc.grpc.status_code", grpcCode))
-			}()
-
-			res, err = next(ctx, req)
-			return res, err
+	return &rpcLoggerInterceptor{}
+}
+
+type rpcLoggerInterceptor struct{}
+
+func (i *rpcLoggerInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (res connect.AnyResponse, err error) {
+		defer logRPC(ctx, req.Spec(), &err)
+		res, err = next(ctx, req)
+		return res, err
+	}
+}
+
+func (i *rpcLoggerInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *rpcLoggerInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) (err error) {
+		defer logRPC(ctx, conn.Spec(), &err)
+		err = next(ctx, conn)
+		return err
+	}
+}
+
+// errorInterceptor converts errors returned by handlers to connect errors that are
+// safe to return to clients.
+type errorInterceptor struct{}
+
+func (i *errorInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		res, err := next(ctx, req)
+		if err != nil {
+			return nil, rpcerr.ToConnectError(err)
 		}
-	})
+		return res, nil
+	}
+}
+
+func (i *errorInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *errorInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := next(ctx, conn); err != nil {
+			return rpcerr.ToConnectError(err)
+		}
+		return nil
+	}
+}
+
+// addLogAttr adds an attribute to the request log, replaced in tests.
+var addLogAttr = requestlog.AddExtraAttr
+
+// logRPC adds attributes for the RPC to the request log. It must be deferred
+// so it can observe panics.
+func logRPC(ctx context.Context, spec connect.Spec, err *error) {
+	svc, method := parseFullMethod(spec.Procedure)
+	addLogAttr(ctx, slog.String("rpc.service", svc))
+	addLogAttr(ctx, slog.String("rpc.method", method))
+
+	grpcCode := 0
+	if p := recover(); p != nil {
+		defer panic(p)
+		grpcCode = int(connect.CodeUnknown)
+	} else if *err != nil {
+		grpcCode = int(connect.CodeOf(*err))
+		addLogAttr(ctx, slog.String("error", rpcerr.Cause(*err).Error()))
+	}
+
+	addLogAttr(ctx, slog.Int("rpc.grpc.status_code", grpcCode))
 }
 
 // We assume a well formed method since we only use this from an interceptor.
@@ -0,0 +1,501 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+
+	"github.com/curioswitch/go-curiostack/rpcerr"
+)
+
+func TestHandleConnectUnaryReadMaxBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		serviceSize int
+		opts        []connect.HandlerOption
+
+		code connect.Code
+	}{
+		{
+			name:        "under server limit",
+			serviceSize: 50,
+		},
+		{
+			name:        "over server limit",
+			serviceSize: 200,
+			code:        connect.CodeResourceExhausted,
+		},
+		{
+			name:        "procedure raises limit",
+			serviceSize: 200,
+			opts:        []connect.HandlerOption{ReadMaxBytes(1000)},
+		},
+		{
+			name:        "procedure lowers limit",
+			serviceSize: 50,
+			opts:        []connect.HandlerOption{ReadMaxBytes(20)},
+			code:        connect.CodeResourceExhausted,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.MaxRequestBytes = 100
+			s.mux = NewMuxFromConfig(s.conf)
+
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(_ context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+				},
+				nil,
+				tc.opts...,
+			)
+
+			srv := httptest.NewServer(s.mux)
+			defer srv.Close()
+
+			client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+				http.DefaultClient,
+				srv.URL+healthpb.Health_Check_FullMethodName,
+			)
+			res, err := client.CallUnary(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{
+				Service: strings.Repeat("a", tc.serviceSize),
+			}))
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Msg.GetStatus())
+		})
+	}
+}
+
+func TestHandleConnectStreamReadMaxBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		messageSize int
+		messages    int
+		opts        []connect.HandlerOption
+
+		code connect.Code
+	}{
+		{
+			name:        "under server limit",
+			messageSize: 50,
+			messages:    1,
+		},
+		{
+			name:        "total over server limit",
+			messageSize: 50,
+			messages:    10,
+		},
+		{
+			name:        "message over server limit",
+			messageSize: 200,
+			messages:    1,
+			code:        connect.CodeResourceExhausted,
+		},
+		{
+			name:        "procedure raises limit",
+			messageSize: 200,
+			messages:    10,
+			opts:        []connect.HandlerOption{ReadMaxBytes(1000)},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.MaxRequestBytes = 100
+			s.mux = NewMuxFromConfig(s.conf)
+
+			HandleConnectClientStream(s,
+				testpb.TestService_StreamingInputCall_FullMethodName,
+				func(_ context.Context, stream *connect.ClientStream[testpb.StreamingInputCallRequest]) (*testpb.StreamingInputCallResponse, error) {
+					size := 0
+					for stream.Receive() {
+						size += len(stream.Msg().GetPayload().GetBody())
+					}
+					if err := stream.Err(); err != nil {
+						return nil, err
+					}
+					return &testpb.StreamingInputCallResponse{AggregatedPayloadSize: int32(size)}, nil //nolint:gosec // small test payloads
+				},
+				tc.opts...,
+			)
+			srv := newTestHTTP2Server(t, s)
+
+			client := connect.NewClient[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse](
+				srv.Client(),
+				srv.URL+testpb.TestService_StreamingInputCall_FullMethodName,
+			)
+			stream := client.CallClientStream(t.Context())
+			for range tc.messages {
+				if err := stream.Send(&testpb.StreamingInputCallRequest{
+					Payload: &testpb.Payload{Body: []byte(strings.Repeat("a", tc.messageSize))},
+				}); err != nil {
+					break
+				}
+			}
+			res, err := stream.CloseAndReceive()
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, int32(tc.messageSize*tc.messages), res.Msg.GetAggregatedPayloadSize()) //nolint:gosec // small test payloads
+		})
+	}
+}
+
+func TestHandleConnectUnaryErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+
+		code    connect.Code
+		message string
+	}{
+		{
+			name: "plain error",
+			err:  fmt.Errorf("reading /etc/service.conf: %w", io.ErrUnexpectedEOF),
+			code: connect.CodeInternal,
+		},
+		{
+			name: "wrapped sentinel",
+			err:  fmt.Errorf("service %s: %w", "missing", rpcerr.ErrNotFound),
+			code: connect.CodeNotFound,
+		},
+		{
+			name:    "rpcerr",
+			err:     rpcerr.New(connect.CodeFailedPrecondition, "service is paused"),
+			code:    connect.CodeFailedPrecondition,
+			message: "service is paused",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(_ context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return nil, tc.err
+				},
+				nil,
+			)
+
+			srv := httptest.NewServer(s.mux)
+			defer srv.Close()
+
+			client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+				http.DefaultClient,
+				srv.URL+healthpb.Health_Check_FullMethodName,
+			)
+			_, err := client.CallUnary(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+			var cerr *connect.Error
+			require.ErrorAs(t, err, &cerr)
+			require.Equal(t, tc.code, cerr.Code())
+			require.Equal(t, tc.message, cerr.Message())
+		})
+	}
+}
+
+func TestHandleConnectStreams(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(s *Server, err error)
+		call   func(ctx context.Context, client *http.Client, url string) (string, error)
+
+		method string
+		res    string
+	}{
+		{
+			name: "server stream",
+			handle: func(s *Server, err error) {
+				HandleConnectServerStream(s,
+					testpb.TestService_StreamingOutputCall_FullMethodName,
+					func(_ context.Context, req *testpb.StreamingOutputCallRequest, stream *connect.ServerStream[testpb.StreamingOutputCallResponse]) error {
+						if err != nil {
+							return err
+						}
+						for range req.GetResponseParameters() {
+							if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+								return err
+							}
+						}
+						return nil
+					},
+					nil,
+				)
+			},
+			call: func(ctx context.Context, client *http.Client, url string) (string, error) {
+				c := connect.NewClient[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse](
+					client, url+testpb.TestService_StreamingOutputCall_FullMethodName)
+				stream, err := c.CallServerStream(ctx, connect.NewRequest(&testpb.StreamingOutputCallRequest{
+					ResponseParameters: []*testpb.ResponseParameters{{}, {}},
+					Payload:            &testpb.Payload{Body: []byte("hello")},
+				}))
+				if err != nil {
+					return "", err
+				}
+				var bodies []string
+				for stream.Receive() {
+					bodies = append(bodies, string(stream.Msg().GetPayload().GetBody()))
+				}
+				return strings.Join(bodies, ","), stream.Err()
+			},
+			method: "StreamingOutputCall",
+			res:    "hello,hello",
+		},
+		{
+			name: "client stream",
+			handle: func(s *Server, err error) {
+				HandleConnectClientStream(s,
+					testpb.TestService_StreamingInputCall_FullMethodName,
+					func(_ context.Context, stream *connect.ClientStream[testpb.StreamingInputCallRequest]) (*testpb.StreamingInputCallResponse, error) {
+						size := 0
+						for stream.Receive() {
+							size += len(stream.Msg().GetPayload().GetBody())
+						}
+						if err != nil {
+							return nil, err
+						}
+						return &testpb.StreamingInputCallResponse{AggregatedPayloadSize: int32(size)}, stream.Err() //nolint:gosec // small test payloads
+					},
+				)
+			},
+			call: func(ctx context.Context, client *http.Client, url string) (string, error) {
+				c := connect.NewClient[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse](
+					client, url+testpb.TestService_StreamingInputCall_FullMethodName)
+				stream := c.CallClientStream(ctx)
+				for _, body := range []string{"a", "bc"} {
+					if err := stream.Send(&testpb.StreamingInputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+						return "", err
+					}
+				}
+				res, err := stream.CloseAndReceive()
+				if err != nil {
+					return "", err
+				}
+				return strconv.Itoa(int(res.Msg.GetAggregatedPayloadSize())), nil
+			},
+			method: "StreamingInputCall",
+			res:    "3",
+		},
+		{
+			name: "bidi stream",
+			handle: func(s *Server, err error) {
+				HandleConnectBidiStream(s,
+					testpb.TestService_FullDuplexCall_FullMethodName,
+					func(_ context.Context, stream *connect.BidiStream[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse]) error {
+						for {
+							req, rerr := stream.Receive()
+							if errors.Is(rerr, io.EOF) {
+								return err
+							}
+							if rerr != nil {
+								return rerr
+							}
+							if err := stream.Send(&testpb.StreamingOutputCallResponse{Payload: req.GetPayload()}); err != nil {
+								return err
+							}
+						}
+					},
+				)
+			},
+			call: func(ctx context.Context, client *http.Client, url string) (string, error) {
+				c := connect.NewClient[testpb.StreamingOutputCallRequest, testpb.StreamingOutputCallResponse](
+					client, url+testpb.TestService_FullDuplexCall_FullMethodName)
+				stream := c.CallBidiStream(ctx)
+				for _, body := range []string{"a", "b"} {
+					if err := stream.Send(&testpb.StreamingOutputCallRequest{Payload: &testpb.Payload{Body: []byte(body)}}); err != nil {
+						return "", err
+					}
+				}
+				if err := stream.CloseRequest(); err != nil {
+					return "", err
+				}
+				var bodies []string
+				for {
+					res, err := stream.Receive()
+					if errors.Is(err, io.EOF) {
+						return strings.Join(bodies, ","), nil
+					}
+					if err != nil {
+						return "", err
+					}
+					bodies = append(bodies, string(res.GetPayload().GetBody()))
+				}
+			},
+			method: "FullDuplexCall",
+			res:    "a,b",
+		},
+	}
+
+	for _, tc := range tests {
+		for _, fail := range []bool{false, true} {
+			name := tc.name
+			if fail {
+				name += " error"
+			}
+			t.Run(name, func(t *testing.T) {
+				var mu sync.Mutex
+				attrs := map[string]slog.Value{}
+				origAddLogAttr := addLogAttr
+				addLogAttr = func(_ context.Context, attr slog.Attr) {
+					mu.Lock()
+					defer mu.Unlock()
+					attrs[attr.Key] = attr.Value
+				}
+				t.Cleanup(func() {
+					addLogAttr = origAddLogAttr
+				})
+
+				var handlerErr error
+				if fail {
+					handlerErr = rpcerr.New(connect.CodeFailedPrecondition, "stream is paused")
+				}
+
+				s := newTestServer(t)
+				tc.handle(s, handlerErr)
+				srv := newTestHTTP2Server(t, s)
+
+				res, err := tc.call(t.Context(), srv.Client(), srv.URL)
+				if fail {
+					require.Equal(t, connect.CodeFailedPrecondition, connect.CodeOf(err))
+				} else {
+					require.NoError(t, err)
+					require.Equal(t, tc.res, res)
+				}
+
+				mu.Lock()
+				defer mu.Unlock()
+				require.Equal(t, "grpc.testing.TestService", attrs["rpc.service"].String())
+				require.Equal(t, tc.method, attrs["rpc.method"].String())
+				if fail {
+					require.Equal(t, int64(connect.CodeFailedPrecondition), attrs["rpc.grpc.status_code"].Int64())
+					require.Contains(t, attrs["error"].String(), "stream is paused")
+				} else {
+					require.Equal(t, int64(0), attrs["rpc.grpc.status_code"].Int64())
+					require.NotContains(t, attrs, "error")
+				}
+			})
+		}
+	}
+}
+
+func TestHandleConnectPanics(t *testing.T) {
+	tests := []struct {
+		name   string
+		handle func(s *Server)
+
+		msg string
+	}{
+		{
+			name: "procedure without leading slash",
+			handle: func(s *Server) {
+				HandleConnectUnary(s, testpb.TestService_UnaryCall_FullMethodName[1:],
+					func(context.Context, *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+						return nil, nil //nolint:nilnil // not called
+					}, nil)
+			},
+			msg: "procedure must be a constant from connect generated code, such as curioapi.CurioServiceMethodProcedure",
+		},
+		{
+			name: "unknown method",
+			handle: func(s *Server) {
+				HandleConnectUnary(s, "/grpc.testing.TestService/Unknown",
+					func(context.Context, *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+						return nil, nil //nolint:nilnil // not called
+					}, nil)
+			},
+			msg: "procedure must be a constant from connect generated code, such as curioapi.CurioServiceMethodProcedure",
+		},
+		{
+			name: "request type mismatch",
+			handle: func(s *Server) {
+				HandleConnectUnary(s, testpb.TestService_UnaryCall_FullMethodName,
+					func(context.Context, *testpb.Empty) (*testpb.SimpleResponse, error) {
+						return nil, nil //nolint:nilnil // not called
+					}, nil)
+			},
+			msg: "request type must match the input type of the procedure in the proto",
+		},
+		{
+			name: "response type mismatch",
+			handle: func(s *Server) {
+				HandleConnectServerStream(s, testpb.TestService_StreamingOutputCall_FullMethodName,
+					func(context.Context, *testpb.StreamingOutputCallRequest, *connect.ServerStream[testpb.SimpleResponse]) error {
+						return nil
+					}, nil)
+			},
+			msg: "response type must match the output type of the procedure in the proto",
+		},
+		{
+			name: "unary for streaming method",
+			handle: func(s *Server) {
+				HandleConnectUnary(s, testpb.TestService_StreamingOutputCall_FullMethodName,
+					func(context.Context, *testpb.StreamingOutputCallRequest) (*testpb.StreamingOutputCallResponse, error) {
+						return nil, nil //nolint:nilnil // not called
+					}, nil)
+			},
+			msg: "procedure must be a unary method, use the streaming variants of HandleConnect for streaming methods",
+		},
+		{
+			name: "server stream for unary method",
+			handle: func(s *Server) {
+				HandleConnectServerStream(s, testpb.TestService_UnaryCall_FullMethodName,
+					func(context.Context, *testpb.SimpleRequest, *connect.ServerStream[testpb.SimpleResponse]) error {
+						return nil
+					}, nil)
+			},
+			msg: "procedure must be a server streaming method",
+		},
+		{
+			name: "client stream for bidi method",
+			handle: func(s *Server) {
+				HandleConnectClientStream(s, testpb.TestService_FullDuplexCall_FullMethodName,
+					func(context.Context, *connect.ClientStream[testpb.StreamingOutputCallRequest]) (*testpb.StreamingOutputCallResponse, error) {
+						return nil, nil //nolint:nilnil // not called
+					})
+			},
+			msg: "procedure must be a client streaming method",
+		},
+		{
+			name: "bidi stream for client stream method",
+			handle: func(s *Server) {
+				HandleConnectBidiStream(s, testpb.TestService_StreamingInputCall_FullMethodName,
+					func(context.Context, *connect.BidiStream[testpb.StreamingInputCallRequest, testpb.StreamingInputCallResponse]) error {
+						return nil
+					})
+			},
+			msg: "procedure must be a bidirectional streaming method",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			require.PanicsWithValue(t, tc.msg, func() {
+				tc.handle(s)
+			})
+		})
+	}
+}
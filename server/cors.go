@@ -0,0 +1,30 @@
+package server
+
+import (
+	"net/http"
+
+	connectcors "connectrpc.com/cors"
+	"github.com/rs/cors"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+// corsMiddleware returns middleware handling cross-origin requests as configured,
+// or nil if CORS is disabled. Preflight requests are responded to directly without
+// calling the next handler.
+func corsMiddleware(conf *config.CORS) func(http.Handler) http.Handler {
+	if len(conf.AllowedOrigins) == 0 {
+		return nil
+	}
+
+	c := cors.New(cors.Options{
+		AllowedOrigins: conf.AllowedOrigins,
+		// Connect uses GET and POST, other methods may be used by REST routes.
+		AllowedMethods:   append(connectcors.AllowedMethods(), http.MethodPut, http.MethodPatch, http.MethodDelete),
+		AllowedHeaders:   append(append(connectcors.AllowedHeaders(), "Authorization"), conf.AllowedHeaders...),
+		ExposedHeaders:   append(connectcors.ExposedHeaders(), conf.ExposedHeaders...),
+		AllowCredentials: conf.AllowCredentials,
+		MaxAge:           int(conf.MaxAge.Seconds()),
+	})
+	return c.Handler
+}
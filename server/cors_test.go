@@ -0,0 +1,93 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name    string
+		origins []string
+		method  string
+		origin  string
+
+		status      int
+		allowOrigin string
+	}{
+		{
+			name:        "preflight allowed",
+			origins:     []string{"https://example.com"},
+			method:      http.MethodOptions,
+			origin:      "https://example.com",
+			status:      http.StatusNoContent,
+			allowOrigin: "https://example.com",
+		},
+		{
+			name:        "preflight wildcard subdomain",
+			origins:     []string{"https://*.example.com"},
+			method:      http.MethodOptions,
+			origin:      "https://app.example.com",
+			status:      http.StatusNoContent,
+			allowOrigin: "https://app.example.com",
+		},
+		{
+			name:    "preflight not allowed",
+			origins: []string{"https://example.com"},
+			method:  http.MethodOptions,
+			origin:  "https://evil.com",
+			status:  http.StatusNoContent,
+		},
+		{
+			name:        "request allowed",
+			origins:     []string{"https://example.com"},
+			method:      http.MethodPost,
+			origin:      "https://example.com",
+			status:      http.StatusOK,
+			allowOrigin: "https://example.com",
+		},
+		{
+			name:   "disabled",
+			method: http.MethodPost,
+			origin: "https://example.com",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.CORS.AllowedOrigins = tc.origins
+			s.conf.Server.CORS.AllowedHeaders = []string{"X-Custom"}
+			mux := NewMuxFromConfig(s.conf)
+			mux.Post("/test.Service/Method", func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			})
+
+			req := httptest.NewRequest(tc.method, "/test.Service/Method", nil)
+			req.Header.Set("Origin", tc.origin)
+			if tc.method == http.MethodOptions {
+				req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+				// Browsers send sorted, lowercase headers.
+				req.Header.Set("Access-Control-Request-Headers", "authorization,connect-protocol-version,content-type,x-custom")
+			}
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+
+			require.Equal(t, tc.status, res.Code)
+			require.Equal(t, tc.allowOrigin, res.Header().Get("Access-Control-Allow-Origin"))
+			if tc.allowOrigin == "" {
+				return
+			}
+			if tc.method == http.MethodOptions {
+				require.Equal(t, "authorization,connect-protocol-version,content-type,x-custom", res.Header().Get("Access-Control-Allow-Headers"))
+				require.Equal(t, "7200", res.Header().Get("Access-Control-Max-Age"))
+			} else {
+				require.Contains(t, res.Header().Get("Access-Control-Expose-Headers"), "Grpc-Status")
+			}
+		})
+	}
+}
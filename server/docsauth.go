@@ -0,0 +1,347 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+const (
+	googleAuthorizationURL = "https://accounts.google.com/o/oauth2/v2/auth"
+
+	defaultFirebaseSDKVersion = "10.14.1"
+
+	// hostingFirebaseSDKVersion is the version of the namespaced Firebase JS SDK loaded from
+	// Firebase Hosting when the config of the project is read from its auth domain.
+	hostingFirebaseSDKVersion = "8.10.1"
+
+	defaultAPIKeyHeader = "X-API-Key"
+)
+
+var (
+	errInvalidDocsAuth       = errors.New("invalid docs auth provider")
+	errMissingDocsAuthConfig = errors.New("missing docs auth config")
+)
+
+// DocsAuth authorizes requests sent from the docs handler, generally by adding a
+// header with credentials of the user of the docs. Create one with a function such as
+// DocsBearerTokenAuth and enable it with EnableDocsAuth.
+type DocsAuth interface {
+	// script returns the JavaScript injected into the docs handler, which registers a
+	// header provider with window.armeria.registerHeaderProvider.
+	script() string
+}
+
+// EnableDocsAuth enables auth for requests sent from the docs handler, taking
+// precedence over config.DocsAuth.
+func EnableDocsAuth(s *Server, auth DocsAuth) {
+	s.docsAuth = auth
+}
+
+// EnableDocsFirebaseAuth enables Firebase auth for the docs handler. The domain
+// must be the auth domain of the Firebase project.
+//
+// Firebase credentials of the browser, generally set by running the actual web app
+// locally, will be read and added as authorization headers in requests to the
+// server. The Firebase JS SDK and config of the project are loaded from the domain. It
+// is a shorthand for EnableDocsAuth with DocsFirebaseAuth.
+func EnableDocsFirebaseAuth(s *Server, domain string) {
+	EnableDocsAuth(s, DocsFirebaseAuth(&config.DocsFirebaseAuth{AuthDomain: domain}))
+}
+
+// DocsBearerTokenAuth returns a DocsAuth that sends a bearer token in the Authorization
+// header. The token is entered in the docs when first sending a request and can be
+// changed with a button added to the page. It is saved in the browser's local storage.
+func DocsBearerTokenAuth() DocsAuth {
+	return &promptDocsAuth{
+		label:  "Bearer token",
+		header: "Authorization",
+		prefix: "Bearer ",
+	}
+}
+
+// DocsAPIKeyAuth returns a DocsAuth that sends an API key in header, defaulting to
+// "X-API-Key" if empty. The key is entered in the docs when first sending a request and
+// can be changed with a button added to the page. It is saved in the browser's local
+// storage.
+func DocsAPIKeyAuth(header string) DocsAuth {
+	if header == "" {
+		header = defaultAPIKeyHeader
+	}
+	return &promptDocsAuth{
+		label:  "API key",
+		header: header,
+	}
+}
+
+// DocsOIDCAuth returns a DocsAuth that signs in with the OpenID Connect implicit flow at
+// authorizationURL with the OAuth client clientID and sends the ID token as a bearer
+// token in the Authorization header. The user is redirected to sign in when sending a
+// request without a valid token. The docs URL, such as
+// "http://localhost:8080/internal/docs/", must be an allowed redirect URI of the client.
+func DocsOIDCAuth(authorizationURL string, clientID string) DocsAuth {
+	return &oidcDocsAuth{
+		authorizationURL: authorizationURL,
+		clientID:         clientID,
+	}
+}
+
+// DocsGoogleAuth returns a DocsAuth that signs in with Google with the OAuth client
+// clientID, as DocsOIDCAuth.
+func DocsGoogleAuth(clientID string) DocsAuth {
+	return DocsOIDCAuth(googleAuthorizationURL, clientID)
+}
+
+// DocsFirebaseAuth returns a DocsAuth that sends the Firebase ID token of the user signed
+// in to the Firebase project as a bearer token in the Authorization header. The user is
+// generally signed in by running the actual web app on the same origin.
+//
+// If conf has an API key, the modular Firebase JS SDK is loaded and initialized with it.
+// Otherwise, the SDK and config of the project are loaded from the auth domain, as served
+// by Firebase Hosting for every project.
+func DocsFirebaseAuth(conf *config.DocsFirebaseAuth) DocsAuth {
+	a := &firebaseDocsAuth{
+		authDomain:  conf.AuthDomain,
+		apiKey:      conf.APIKey,
+		emulatorURL: conf.EmulatorURL,
+		sdkVersion:  conf.SDKVersion,
+	}
+	if a.sdkVersion == "" {
+		a.sdkVersion = defaultFirebaseSDKVersion
+	}
+	return a
+}
+
+// DocsScriptAuth returns a DocsAuth with custom JavaScript, which must register a function
+// returning a promise of headers to add to requests with
+// window.armeria.registerHeaderProvider.
+func DocsScriptAuth(script string) DocsAuth {
+	return scriptDocsAuth(script)
+}
+
+// docsAuthFromConfig returns the DocsAuth for the provider configured in conf.
+func docsAuthFromConfig(conf *config.DocsAuth) (DocsAuth, error) {
+	switch strings.ToLower(conf.Provider) {
+	case "bearer":
+		return DocsBearerTokenAuth(), nil
+	case "apikey":
+		return DocsAPIKeyAuth(conf.APIKeyHeader), nil
+	case "google":
+		authURL := conf.OIDC.AuthorizationURL
+		if authURL == "" {
+			authURL = googleAuthorizationURL
+		}
+		if conf.OIDC.ClientID == "" {
+			return nil, fmt.Errorf("server: %w: oidc.clientID is required for provider %q", errMissingDocsAuthConfig, conf.Provider)
+		}
+		return DocsOIDCAuth(authURL, conf.OIDC.ClientID), nil
+	case "oidc":
+		if conf.OIDC.AuthorizationURL == "" || conf.OIDC.ClientID == "" {
+			return nil, fmt.Errorf("server: %w: oidc.authorizationURL and oidc.clientID are required for provider %q", errMissingDocsAuthConfig, conf.Provider)
+		}
+		return DocsOIDCAuth(conf.OIDC.AuthorizationURL, conf.OIDC.ClientID), nil
+	case "firebase":
+		if conf.Firebase.AuthDomain == "" {
+			return nil, fmt.Errorf("server: %w: firebase.authDomain is required for provider %q", errMissingDocsAuthConfig, conf.Provider)
+		}
+		return DocsFirebaseAuth(&conf.Firebase), nil
+	default:
+		return nil, fmt.Errorf("server: %w: %q", errInvalidDocsAuth, conf.Provider)
+	}
+}
+
+type scriptDocsAuth string
+
+func (a scriptDocsAuth) script() string {
+	return string(a)
+}
+
+// promptDocsAuth sends a credential entered by the user in a header.
+type promptDocsAuth struct {
+	label  string
+	header string
+	prefix string
+}
+
+func (a *promptDocsAuth) script() string {
+	return fmt.Sprintf(`
+		(function() {
+			const storageKey = "curiostack.docs." + %[2]s;
+
+			function promptCredential() {
+				const value = window.prompt("Enter " + %[1]s, localStorage.getItem(storageKey) || "");
+				if (value !== null) {
+					localStorage.setItem(storageKey, value.trim());
+				}
+			}
+
+			function addButton() {
+				const button = document.createElement("button");
+				button.textContent = "Set " + %[1]s;
+				button.style.cssText = "position: fixed; bottom: 16px; right: 16px; z-index: 10000;";
+				button.addEventListener("click", promptCredential);
+				document.body.appendChild(button);
+			}
+			if (document.body) {
+				addButton();
+			} else {
+				document.addEventListener("DOMContentLoaded", addButton);
+			}
+
+			window.armeria.registerHeaderProvider(async () => {
+				if (!localStorage.getItem(storageKey)) {
+					promptCredential();
+				}
+				const value = localStorage.getItem(storageKey);
+				return value ? {[%[2]s]: %[3]s + value} : {};
+			});
+		})();
+	`, jsString(a.label), jsString(a.header), jsString(a.prefix))
+}
+
+// oidcDocsAuth signs in with the OpenID Connect implicit flow and sends the ID token.
+type oidcDocsAuth struct {
+	authorizationURL string
+	clientID         string
+}
+
+func (a *oidcDocsAuth) script() string {
+	return fmt.Sprintf(`
+		(function() {
+			const tokenKey = "curiostack.docs.idToken";
+			const hashKey = "curiostack.docs.hash";
+
+			// Handle the redirect back from the provider, restoring the page of the docs.
+			const response = new URLSearchParams(window.location.hash.substring(1));
+			if (response.has("id_token")) {
+				sessionStorage.setItem(tokenKey, response.get("id_token"));
+				history.replaceState(null, "", window.location.pathname + window.location.search + (sessionStorage.getItem(hashKey) || ""));
+			}
+
+			function valid(token) {
+				try {
+					const payload = token.split(".")[1].replace(/-/g, "+").replace(/_/g, "/");
+					return JSON.parse(atob(payload)).exp * 1000 > Date.now() + 60000;
+				} catch {
+					return false;
+				}
+			}
+
+			function signIn() {
+				sessionStorage.setItem(hashKey, window.location.hash);
+				const params = new URLSearchParams({
+					client_id: %[2]s,
+					response_type: "id_token",
+					scope: "openid email profile",
+					redirect_uri: window.location.origin + window.location.pathname,
+					nonce: crypto.randomUUID(),
+				});
+				window.location.assign(%[1]s + "?" + params);
+			}
+
+			window.armeria.registerHeaderProvider(async () => {
+				const token = sessionStorage.getItem(tokenKey);
+				if (!token || !valid(token)) {
+					signIn();
+					return {};
+				}
+				return {"Authorization": "Bearer " + token};
+			});
+		})();
+	`, jsString(a.authorizationURL), jsString(a.clientID))
+}
+
+// firebaseDocsAuth sends the ID token of the user signed in with the Firebase JS SDK.
+type firebaseDocsAuth struct {
+	authDomain  string
+	apiKey      string
+	emulatorURL string
+	sdkVersion  string
+}
+
+func (a *firebaseDocsAuth) script() string {
+	if a.apiKey == "" {
+		return a.hostingScript()
+	}
+	return fmt.Sprintf(`
+		(function() {
+			const auth = (async () => {
+				const sdk = "https://www.gstatic.com/firebasejs/" + %[1]s;
+				const { initializeApp } = await import(sdk + "/firebase-app.js");
+				const { getAuth, connectAuthEmulator } = await import(sdk + "/firebase-auth.js");
+
+				const auth = getAuth(initializeApp({apiKey: %[3]s, authDomain: %[2]s}));
+				const emulatorURL = %[4]s;
+				if (emulatorURL) {
+					connectAuthEmulator(auth, emulatorURL, {disableWarnings: true});
+				}
+				await auth.authStateReady();
+				return auth;
+			})();
+
+			window.armeria.registerHeaderProvider(async () => {
+				const user = (await auth).currentUser;
+				if (!user) {
+					return {};
+				}
+				return {"Authorization": "Bearer " + await user.getIdToken()};
+			});
+		})();
+	`, jsString(a.sdkVersion), jsString(a.authDomain), jsString(a.apiKey), jsString(a.emulatorURL))
+}
+
+// hostingScript loads the namespaced Firebase JS SDK and the config of the project from
+// the reserved URLs of Firebase Hosting on the auth domain. Scripts are included with
+// script tags since Hosting does not serve them with CORS headers.
+func (a *firebaseDocsAuth) hostingScript() string {
+	return fmt.Sprintf(`
+		(function() {
+			function include(url) {
+				return new Promise((resolve, reject) => {
+					const script = document.createElement("script");
+					script.src = url;
+					script.onload = resolve;
+					script.onerror = () => reject(new Error("failed to load " + url));
+					document.head.appendChild(script);
+				});
+			}
+
+			const auth = (async () => {
+				const base = "https://" + %[1]s + "/__/firebase/";
+				await include(base + %[2]s + "/firebase-app.js");
+				await include(base + %[2]s + "/firebase-auth.js");
+				await include(base + "init.js");
+
+				const auth = firebase.auth();
+				const emulatorURL = %[3]s;
+				if (emulatorURL) {
+					auth.useEmulator(emulatorURL);
+				}
+				await new Promise((resolve) => {
+					const unsubscribe = auth.onAuthStateChanged(() => {
+						unsubscribe();
+						resolve();
+					});
+				});
+				return auth;
+			})();
+
+			window.armeria.registerHeaderProvider(async () => {
+				const user = (await auth).currentUser;
+				if (!user) {
+					return {};
+				}
+				return {"Authorization": "Bearer " + await user.getIdToken()};
+			});
+		})();
+	`, jsString(a.authDomain), jsString(hostingFirebaseSDKVersion), jsString(a.emulatorURL))
+}
+
+// jsString returns s as a JavaScript string literal.
+func jsString(s string) string {
+	b, _ := json.Marshal(s) // marshaling a string never fails
+	return string(b)
+}
@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+func TestDocsAuth(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.DocsAuth
+		auth DocsAuth
+		// firebaseDomain is passed to EnableDocsFirebaseAuth if set.
+		firebaseDomain string
+
+		contains []string
+		err      error
+	}{
+		{
+			name: "none",
+		},
+		{
+			name:     "bearer",
+			conf:     config.DocsAuth{Provider: "bearer"},
+			contains: []string{`"Authorization"`, `"Bearer "`, "window.prompt"},
+		},
+		{
+			name:     "api key",
+			conf:     config.DocsAuth{Provider: "apiKey", APIKeyHeader: "X-Api-Key"},
+			contains: []string{`"X-Api-Key"`, "window.prompt"},
+		},
+		{
+			name:     "api key default header",
+			conf:     config.DocsAuth{Provider: "apiKey"},
+			contains: []string{`"X-API-Key"`, "window.prompt"},
+		},
+		{
+			name:     "google",
+			conf:     config.DocsAuth{Provider: "google", OIDC: config.DocsOIDCAuth{ClientID: "client"}},
+			contains: []string{`"https://accounts.google.com/o/oauth2/v2/auth"`, `client_id: "client"`},
+		},
+		{
+			name: "oidc",
+			conf: config.DocsAuth{Provider: "oidc", OIDC: config.DocsOIDCAuth{
+				AuthorizationURL: "https://auth.example.com/authorize",
+				ClientID:         "client",
+			}},
+			contains: []string{`"https://auth.example.com/authorize"`, `client_id: "client"`},
+		},
+		{
+			name: "firebase",
+			conf: config.DocsAuth{Provider: "firebase", Firebase: config.DocsFirebaseAuth{
+				AuthDomain:  "example.firebaseapp.com",
+				EmulatorURL: "http://localhost:9099",
+				SDKVersion:  "10.14.1",
+			}},
+			contains: []string{
+				`"https://" + "example.firebaseapp.com" + "/__/firebase/"`,
+				`include(base + "8.10.1" + "/firebase-app.js")`,
+				`include(base + "init.js")`,
+				`const emulatorURL = "http://localhost:9099"`,
+			},
+		},
+		{
+			name: "firebase api key",
+			conf: config.DocsAuth{Provider: "firebase", Firebase: config.DocsFirebaseAuth{
+				AuthDomain:  "example.firebaseapp.com",
+				APIKey:      "key",
+				EmulatorURL: "http://localhost:9099",
+				SDKVersion:  "10.14.1",
+			}},
+			contains: []string{
+				`"https://www.gstatic.com/firebasejs/" + "10.14.1"`,
+				`apiKey: "key", authDomain: "example.firebaseapp.com"`,
+				`const emulatorURL = "http://localhost:9099"`,
+			},
+		},
+		{
+			name:           "enable firebase",
+			firebaseDomain: "example.firebaseapp.com",
+			contains: []string{
+				`"https://" + "example.firebaseapp.com" + "/__/firebase/"`,
+				`include(base + "init.js")`,
+				`firebase.auth()`,
+			},
+		},
+		{
+			name:     "function overrides config",
+			conf:     config.DocsAuth{Provider: "bearer"},
+			auth:     DocsScriptAuth("window.armeria.registerHeaderProvider(custom);"),
+			contains: []string{"registerHeaderProvider(custom)"},
+		},
+		{
+			name:     "firebase function",
+			auth:     DocsFirebaseAuth(&config.DocsFirebaseAuth{AuthDomain: "example.firebaseapp.com", APIKey: "key"}),
+			contains: []string{`"https://www.gstatic.com/firebasejs/" + "` + defaultFirebaseSDKVersion + `"`},
+		},
+		{
+			name: "google missing client",
+			conf: config.DocsAuth{Provider: "google"},
+			err:  errMissingDocsAuthConfig,
+		},
+		{
+			name: "oidc missing authorization url",
+			conf: config.DocsAuth{Provider: "oidc", OIDC: config.DocsOIDCAuth{ClientID: "client"}},
+			err:  errMissingDocsAuthConfig,
+		},
+		{
+			name: "oidc missing client",
+			conf: config.DocsAuth{Provider: "oidc", OIDC: config.DocsOIDCAuth{
+				AuthorizationURL: "https://auth.example.com/authorize",
+			}},
+			err: errMissingDocsAuthConfig,
+		},
+		{
+			name: "firebase missing auth domain",
+			conf: config.DocsAuth{Provider: "firebase"},
+			err:  errMissingDocsAuthConfig,
+		},
+		{
+			name: "unknown provider",
+			conf: config.DocsAuth{Provider: "basic"},
+			err:  errInvalidDocsAuth,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.DocsAuth = tc.conf
+			if tc.auth != nil {
+				EnableDocsAuth(s, tc.auth)
+			}
+			if tc.firebaseDomain != "" {
+				EnableDocsFirebaseAuth(s, tc.firebaseDomain)
+			}
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{}, nil
+				},
+				nil,
+			)
+
+			err := s.mountDefaultEndpoints()
+			if tc.err != nil {
+				require.ErrorIs(t, err, tc.err)
+				return
+			}
+			require.NoError(t, err)
+
+			res := serveTestRequest(s, http.MethodGet, "/internal/docs/injected.js")
+			require.Equal(t, http.StatusOK, res.Code)
+			if len(tc.contains) == 0 {
+				require.Empty(t, res.Body.String())
+			}
+			for _, c := range tc.contains {
+				require.Contains(t, res.Body.String(), c)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/encoding/prototext"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+)
+
+var (
+	errInvalidDocsSamplePath      = errors.New("docs sample path must be <service>/<method>.<ext> or <service>/<method>/<name>.<ext>")
+	errUnknownDocsSampleProcedure = errors.New("docs sample for procedure not registered on server")
+	errEmptyDocsSample            = errors.New("docs sample has no requests")
+)
+
+// SetDocsSamples registers files with sample requests for the docs handler, such as an
+// [embed.FS], merged after any passed to HandleConnectUnary. Samples are keyed by
+// procedure name, in a file <service>/<method>.<ext> or, to split many samples into
+// separate files, <service>/<method>/<name>.<ext>. For example,
+//
+//	frontendapi.v1.FrontendService/GetPlace.json
+//	frontendapi.v1.FrontendService/GetPlace/with_filter.txtpb
+//
+// Files with extension .json are parsed as protojson, containing a single request or an
+// array of requests, and files with extension .txtpb or .textproto as a single request in
+// the text format. Other files are ignored. When embedding a directory containing the
+// samples, use [fs.Sub] to pass the directory itself, for example
+//
+//	//go:embed samples
+//	var samplesFS embed.FS
+//
+//	samples, _ := fs.Sub(samplesFS, "samples")
+//	server.SetDocsSamples(s, samples)
+//
+// Samples are parsed as the input type of the procedure when the server is started, and
+// Start returns an error if any are invalid or for procedures not registered on the server.
+func SetDocsSamples(s *Server, samples fs.FS) {
+	s.docsSamples = samples
+}
+
+// loadDocsSamples parses the registered docs samples and adds them to the docs handler.
+func (b *Server) loadDocsSamples() error {
+	if b.docsSamples == nil {
+		return nil
+	}
+
+	return fs.WalkDir(b.docsSamples, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fmt.Errorf("server: reading docs samples: %w", err)
+		}
+		if d.IsDir() {
+			return nil
+		}
+		ext := path.Ext(p)
+		if ext != ".json" && ext != ".txtpb" && ext != ".textproto" {
+			return nil
+		}
+
+		method, err := b.docsSampleMethod(p)
+		if err != nil {
+			return err
+		}
+
+		content, err := fs.ReadFile(b.docsSamples, p)
+		if err != nil {
+			return fmt.Errorf("server: reading docs sample %s: %w", p, err)
+		}
+		reqs, err := parseDocsSample(content, ext, method.Input())
+		if err != nil {
+			return fmt.Errorf("server: parsing docs sample %s: %w", p, err)
+		}
+
+		procedure := "/" + string(method.Parent().FullName()) + "/" + string(method.Name())
+		b.addProtoDocsRequests(procedure, reqs)
+		return nil
+	})
+}
+
+// docsSampleMethod returns the method of the procedure of the docs sample at path p.
+func (b *Server) docsSampleMethod(p string) (protoreflect.MethodDescriptor, error) {
+	parts := strings.Split(strings.TrimSuffix(p, path.Ext(p)), "/")
+	if len(parts) != 2 && len(parts) != 3 {
+		return nil, fmt.Errorf("server: %w: %s", errInvalidDocsSamplePath, p)
+	}
+	svcName, methodName := parts[0], parts[1]
+
+	if !slices.Contains(b.procedures, "/"+svcName+"/"+methodName) {
+		return nil, fmt.Errorf("server: %w: %s", errUnknownDocsSampleProcedure, p)
+	}
+	desc, err := protoregistry.GlobalFiles.FindDescriptorByName(protoreflect.FullName(svcName))
+	if err != nil {
+		return nil, fmt.Errorf("server: finding service for docs sample %s: %w", p, err)
+	}
+	svc, ok := desc.(protoreflect.ServiceDescriptor)
+	if !ok {
+		return nil, fmt.Errorf("server: %w: %s", errUnknownDocsSampleProcedure, p)
+	}
+	method := svc.Methods().ByName(protoreflect.Name(methodName))
+	if method == nil {
+		return nil, fmt.Errorf("server: %w: %s", errUnknownDocsSampleProcedure, p)
+	}
+	return method, nil
+}
+
+// parseDocsSample parses the requests in content, of a file with extension ext, as the
+// message input.
+func parseDocsSample(content []byte, ext string, input protoreflect.MessageDescriptor) ([]proto.Message, error) {
+	mt, err := protoregistry.GlobalTypes.FindMessageByName(input.FullName())
+	if err != nil {
+		return nil, fmt.Errorf("finding request type: %w", err)
+	}
+
+	if ext != ".json" {
+		req := mt.New().Interface()
+		if err := prototext.Unmarshal(content, req); err != nil {
+			return nil, fmt.Errorf("unmarshaling textproto: %w", err)
+		}
+		return []proto.Message{req}, nil
+	}
+
+	raws := []json.RawMessage{content}
+	if trimmed := bytes.TrimSpace(content); len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &raws); err != nil {
+			return nil, fmt.Errorf("unmarshaling JSON array: %w", err)
+		}
+		if len(raws) == 0 {
+			return nil, errEmptyDocsSample
+		}
+	}
+	reqs := make([]proto.Message, len(raws))
+	for i, raw := range raws {
+		req := mt.New().Interface()
+		if err := protojson.Unmarshal(raw, req); err != nil {
+			return nil, fmt.Errorf("unmarshaling protojson: %w", err)
+		}
+		reqs[i] = req
+	}
+	return reqs, nil
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestDocsSamples(t *testing.T) {
+	tests := []struct {
+		name  string
+		files fstest.MapFS
+
+		services []string
+		err      error
+	}{
+		{
+			name: "json",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check.json": {Data: []byte(`{"service": "json"}`)},
+			},
+			services: []string{"code", "json"},
+		},
+		{
+			name: "json array",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check.json": {Data: []byte(`[{"service": "first"}, {"service": "second"}]`)},
+			},
+			services: []string{"code", "first", "second"},
+		},
+		{
+			name: "textproto in directory",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check/b.textproto": {Data: []byte(`service: "b"`)},
+				"grpc.health.v1.Health/Check/a.txtpb":     {Data: []byte(`service: "a"`)},
+				"grpc.health.v1.Health/Check/README.md":   {Data: []byte(`Samples`)},
+			},
+			services: []string{"code", "a", "b"},
+		},
+		{
+			name: "invalid json",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check.json": {Data: []byte(`{"unknown": "field"}`)},
+			},
+		},
+		{
+			name: "invalid textproto",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check.txtpb": {Data: []byte(`service: 1`)},
+			},
+		},
+		{
+			name: "empty json array",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Check.json": {Data: []byte(` [] `)},
+			},
+			err: errEmptyDocsSample,
+		},
+		{
+			name: "unknown method",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Unknown.json": {Data: []byte(`{}`)},
+			},
+			err: errUnknownDocsSampleProcedure,
+		},
+		{
+			name: "unregistered method",
+			files: fstest.MapFS{
+				"grpc.health.v1.Health/Watch.json": {Data: []byte(`{}`)},
+			},
+			err: errUnknownDocsSampleProcedure,
+		},
+		{
+			name: "unregistered service",
+			files: fstest.MapFS{
+				"grpc.health.v1.Other/Check.json": {Data: []byte(`{}`)},
+			},
+			err: errUnknownDocsSampleProcedure,
+		},
+		{
+			name: "invalid path",
+			files: fstest.MapFS{
+				"Check.json": {Data: []byte(`{}`)},
+			},
+			err: errInvalidDocsSamplePath,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{}, nil
+				},
+				[]*healthpb.HealthCheckRequest{{Service: "code"}},
+			)
+			SetDocsSamples(s, tc.files)
+
+			err := s.mountDefaultEndpoints()
+			if tc.services == nil {
+				require.Error(t, err)
+				if tc.err != nil {
+					require.ErrorIs(t, err, tc.err)
+				}
+				return
+			}
+			require.NoError(t, err)
+
+			require.Len(t, s.protoDocsRequests, 1)
+			require.Equal(t, healthpb.Health_Check_FullMethodName, s.protoDocsRequests[0].procedure)
+			services := make([]string, len(s.protoDocsRequests[0].reqs))
+			for i, r := range s.protoDocsRequests[0].reqs {
+				req, ok := r.(*healthpb.HealthCheckRequest)
+				require.True(t, ok)
+				services[i] = req.GetService()
+			}
+			require.Equal(t, tc.services, services)
+		})
+	}
+}
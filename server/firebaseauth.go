@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"connectrpc.com/connect"
+	"firebase.google.com/go/v4/auth"
+)
+
+var (
+	errMissingToken      = errors.New("missing bearer token")
+	errInvalidToken      = errors.New("invalid bearer token")
+	errTenantNotAccepted = errors.New("tenant not accepted")
+)
+
+// FirebaseTokenVerifier verifies Firebase ID tokens. It is implemented by [auth.Client]
+// and [auth.TenantClient].
+type FirebaseTokenVerifier interface {
+	// VerifyIDToken verifies the ID token, returning the decoded token if valid.
+	VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error)
+}
+
+// FirebaseAuthOption is a configuration option for RequireFirebaseAuth.
+type FirebaseAuthOption interface {
+	apply(a *firebaseAuth)
+}
+
+// FirebaseTenants returns a FirebaseAuthOption to only accept tokens for users in one of
+// the given tenants. An empty tenant ID accepts users that are not in a tenant. By default,
+// all tokens accepted by the verifier are accepted.
+func FirebaseTenants(tenantIDs ...string) FirebaseAuthOption {
+	return firebaseTenantsOption(tenantIDs)
+}
+
+type firebaseTenantsOption []string
+
+func (o firebaseTenantsOption) apply(a *firebaseAuth) {
+	a.tenants = append(a.tenants, o...)
+}
+
+// RequireFirebaseAuth requires requests to connect procedures on the server to be
+// authenticated with a Firebase ID token, passed in the Authorization header as a
+// bearer token. Requests without a valid token fail with an unauthenticated error. The
+// decoded token can be retrieved by handlers with FirebaseToken. Procedures that should
+// allow unauthenticated requests can pass SkipFirebaseAuth when being registered.
+//
+// Tokens are only verified for requests to connect procedures registered on the server,
+// not for /internal/ endpoints, static files or other handlers mounted directly on Mux.
+// Requests with an invalid token only fail where authentication is required, other
+// procedures see no token.
+//
+// Use EnableDocsFirebaseAuth to send tokens from the docs handler.
+func RequireFirebaseAuth(s *Server, verifier FirebaseTokenVerifier, opts ...FirebaseAuthOption) {
+	a := &firebaseAuth{verifier: verifier}
+	for _, o := range opts {
+		o.apply(a)
+	}
+	s.firebaseAuth = a
+}
+
+// SkipFirebaseAuth returns a connect.HandlerOption to allow unauthenticated requests to
+// a procedure when RequireFirebaseAuth is enabled. Procedures with a public auth policy
+// declared in their proto options are also exempt. If a valid token is provided anyways,
+// it is still available with FirebaseToken, while an invalid one is ignored. It must be
+// passed directly to a HandleConnect function, not nested in [connect.WithHandlerOptions].
+func SkipFirebaseAuth() connect.HandlerOption {
+	return &skipFirebaseAuthOption{HandlerOption: connect.WithHandlerOptions()}
+}
+
+type skipFirebaseAuthOption struct {
+	connect.HandlerOption
+}
+
+// FirebaseToken returns the verified Firebase ID token of the request, or nil if
+// the request is not authenticated.
+func FirebaseToken(ctx context.Context) *auth.Token {
+	t, _ := ctx.Value(firebaseTokenKey{}).(*auth.Token)
+	return t
+}
+
+type firebaseTokenKey struct{}
+
+// firebaseTokenErrorKey is the context key of the error verifying the Firebase ID token of
+// the request, returned by firebaseAuthInterceptor when authentication is required.
+type firebaseTokenErrorKey struct{}
+
+type firebaseAuth struct {
+	verifier FirebaseTokenVerifier
+	tenants  []string
+}
+
+func (a *firebaseAuth) verify(ctx context.Context, idToken string) (*auth.Token, error) {
+	t, err := a.verifier.VerifyIDToken(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+	if len(a.tenants) > 0 && !slices.Contains(a.tenants, t.Firebase.Tenant) {
+		return nil, fmt.Errorf("%w: %q", errTenantNotAccepted, t.Firebase.Tenant)
+	}
+	return t, nil
+}
+
+// verifyFirebaseToken is middleware that verifies the Firebase ID token of a request to
+// a connect procedure if present, adding it or the error verifying it to the request
+// context.
+func (b *Server) verifyFirebaseToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		a := b.firebaseAuth
+		if a == nil || !b.isConnectProcedure(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		idToken, ok := bearerTokenFromHeader(r.Header)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if b.jwtAuth != nil {
+			// Tokens from configured JWT issuers are verified by jwtAuthInterceptor, which
+			// reuses the parsed token, or nil if it is not from one.
+			parsed := b.jwtAuth.parse(idToken)
+			r = r.WithContext(context.WithValue(r.Context(), parsedJWTKey{}, parsed))
+			if parsed != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		t, err := a.verify(r.Context(), idToken)
+		if err != nil {
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), firebaseTokenErrorKey{}, err)))
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), firebaseTokenKey{}, t)))
+	})
+}
+
+// isConnectProcedure returns whether p is the path of a procedure of a connect service
+// registered on the server.
+func (b *Server) isConnectProcedure(p string) bool {
+	svc, _, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	return slices.Contains(b.services, svc)
+}
+
+func bearerTokenFromHeader(h http.Header) (string, bool) {
+	scheme, token, ok := strings.Cut(h.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", false
+	}
+	return strings.TrimSpace(token), true
+}
+
+// firebaseAuthInterceptor rejects unauthenticated requests when Firebase auth is
+// required. Tokens are verified by verifyFirebaseToken. Requests authenticated with a
+// JWT from a configured issuer by jwtAuthInterceptor are also accepted.
+type firebaseAuthInterceptor struct {
+	s      *Server
+	exempt bool
+}
+
+func (i *firebaseAuthInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if err := i.check(ctx); err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *firebaseAuthInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *firebaseAuthInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		if err := i.check(ctx); err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *firebaseAuthInterceptor) check(ctx context.Context) error {
+	if i.exempt || i.s.firebaseAuth == nil || FirebaseToken(ctx) != nil || JWTPrincipal(ctx) != nil {
+		return nil
+	}
+	if err, ok := ctx.Value(firebaseTokenErrorKey{}).(error); ok {
+		return connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	return connect.NewError(connect.CodeUnauthenticated, errMissingToken)
+}
@@ -0,0 +1,314 @@
+package server
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+
+	"connectrpc.com/connect"
+	"firebase.google.com/go/v4/auth"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/testutil"
+)
+
+func TestRequireFirebaseAuth(t *testing.T) {
+	stub := testutil.NewFirebaseAuthStub(t, "test-project")
+	otherStub := testutil.NewFirebaseAuthStub(t, "test-project")
+
+	token := func(stub *testutil.FirebaseAuthStub, tenantID string) string {
+		t.Helper()
+		tok, err := stub.IDToken("user", tenantID, nil)
+		require.NoError(t, err)
+		return tok
+	}
+
+	tests := []struct {
+		name      string
+		token     string
+		procedure string
+
+		code connect.Code
+		uid  string
+	}{
+		{
+			name:      "no token",
+			procedure: healthpb.Health_Check_FullMethodName,
+			code:      connect.CodeUnauthenticated,
+		},
+		{
+			name:      "valid token",
+			token:     token(stub, ""),
+			procedure: healthpb.Health_Check_FullMethodName,
+			uid:       "user",
+		},
+		{
+			name:      "accepted tenant",
+			token:     token(stub, "tenant-a"),
+			procedure: healthpb.Health_Check_FullMethodName,
+			uid:       "user",
+		},
+		{
+			name:      "other tenant",
+			token:     token(stub, "tenant-b"),
+			procedure: healthpb.Health_Check_FullMethodName,
+			code:      connect.CodeUnauthenticated,
+		},
+		{
+			name:      "invalid token",
+			token:     "invalid",
+			procedure: healthpb.Health_Check_FullMethodName,
+			code:      connect.CodeUnauthenticated,
+		},
+		{
+			name:      "wrong key",
+			token:     token(otherStub, ""),
+			procedure: healthpb.Health_Check_FullMethodName,
+			code:      connect.CodeUnauthenticated,
+		},
+		{
+			name:      "exempt no token",
+			procedure: healthpb.Health_List_FullMethodName,
+		},
+		{
+			name:      "exempt valid token",
+			token:     token(stub, ""),
+			procedure: healthpb.Health_List_FullMethodName,
+			uid:       "user",
+		},
+		{
+			name:      "exempt invalid token",
+			token:     "invalid",
+			procedure: healthpb.Health_List_FullMethodName,
+		},
+	}
+
+	s := newTestServer(t)
+	RequireFirebaseAuth(s, stub, FirebaseTenants("", "tenant-a"))
+	uid := func(ctx context.Context) string {
+		if t := FirebaseToken(ctx); t != nil {
+			return t.UID
+		}
+		return ""
+	}
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			if uid(ctx) != "user" {
+				return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}, nil
+			}
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		nil,
+	)
+	HandleConnectUnary(s,
+		healthpb.Health_List_FullMethodName,
+		func(ctx context.Context, _ *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+			return &healthpb.HealthListResponse{Statuses: map[string]*healthpb.HealthCheckResponse{
+				uid(ctx): {Status: healthpb.HealthCheckResponse_SERVING},
+			}}, nil
+		},
+		nil,
+		SkipFirebaseAuth(),
+	)
+	s.mux.Get("/public", func(w http.ResponseWriter, r *http.Request) {
+		if FirebaseToken(r.Context()) != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	})
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var err error
+			var gotUID string
+			if tc.procedure == healthpb.Health_Check_FullMethodName {
+				client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](http.DefaultClient, srv.URL+tc.procedure)
+				req := connect.NewRequest(&healthpb.HealthCheckRequest{})
+				if tc.token != "" {
+					req.Header().Set("Authorization", "Bearer "+tc.token)
+				}
+				var res *connect.Response[healthpb.HealthCheckResponse]
+				res, err = client.CallUnary(t.Context(), req)
+				if err == nil && res.Msg.GetStatus() == healthpb.HealthCheckResponse_SERVING {
+					gotUID = "user"
+				}
+			} else {
+				client := connect.NewClient[healthpb.HealthListRequest, healthpb.HealthListResponse](http.DefaultClient, srv.URL+tc.procedure)
+				req := connect.NewRequest(&healthpb.HealthListRequest{})
+				if tc.token != "" {
+					req.Header().Set("Authorization", "Bearer "+tc.token)
+				}
+				var res *connect.Response[healthpb.HealthListResponse]
+				res, err = client.CallUnary(t.Context(), req)
+				if err == nil {
+					for k := range res.Msg.GetStatuses() {
+						gotUID = k
+					}
+				}
+			}
+
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.uid, gotUID)
+		})
+	}
+
+	t.Run("mux route with invalid token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/public", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		res := httptest.NewRecorder()
+		s.mux.ServeHTTP(res, req)
+		require.Equal(t, http.StatusOK, res.Code)
+	})
+
+	t.Run("internal endpoints not verified", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/internal/health/ready", nil)
+		req.Header.Set("Authorization", "Bearer invalid")
+		res := httptest.NewRecorder()
+		s.mux.ServeHTTP(res, req)
+		require.Equal(t, http.StatusOK, res.Code)
+	})
+}
+
+func TestRequireFirebaseAuthClient(t *testing.T) {
+	stub := testutil.NewFirebaseAuthEmulatorStub(t, "test-project")
+	fbAuth, err := stub.Client(t.Context())
+	require.NoError(t, err)
+
+	token, err := stub.IDToken("user", "", nil)
+	require.NoError(t, err)
+	disabledToken, err := stub.IDToken("disabled", "", nil)
+	require.NoError(t, err)
+	stub.DisableUser("disabled")
+
+	s := newTestServer(t)
+	RequireFirebaseAuth(s, fbAuth)
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		nil,
+	)
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+	client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](http.DefaultClient, srv.URL+healthpb.Health_Check_FullMethodName)
+
+	req := connect.NewRequest(&healthpb.HealthCheckRequest{})
+	req.Header().Set("Authorization", "Bearer "+token)
+	_, err = client.CallUnary(t.Context(), req)
+	require.NoError(t, err)
+
+	req = connect.NewRequest(&healthpb.HealthCheckRequest{})
+	req.Header().Set("Authorization", "Bearer "+disabledToken)
+	_, err = client.CallUnary(t.Context(), req)
+	require.Equal(t, connect.CodeUnauthenticated, connect.CodeOf(err))
+}
+
+// countingVerifier counts the tokens verified by a FirebaseTokenVerifier.
+type countingVerifier struct {
+	FirebaseTokenVerifier
+	calls atomic.Int32
+}
+
+func (v *countingVerifier) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	v.calls.Add(1)
+	return v.FirebaseTokenVerifier.VerifyIDToken(ctx, idToken)
+}
+
+func TestRequireFirebaseAuthRoutes(t *testing.T) {
+	stub := testutil.NewFirebaseAuthStub(t, "test-project")
+	token, err := stub.IDToken("user", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name string
+		path string
+
+		status   int
+		verified bool
+	}{
+		{
+			name:     "connect procedure",
+			path:     healthpb.Health_Check_FullMethodName,
+			status:   http.StatusOK,
+			verified: true,
+		},
+		{
+			name:   "health",
+			path:   "/internal/health",
+			status: http.StatusOK,
+		},
+		{
+			name:   "health ready",
+			path:   "/internal/health/ready",
+			status: http.StatusOK,
+		},
+		{
+			name:   "static file",
+			path:   "/index.html",
+			status: http.StatusOK,
+		},
+		{
+			name:   "static fallback",
+			path:   "/app/page",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			v := &countingVerifier{FirebaseTokenVerifier: stub}
+
+			s := newTestServer(t)
+			RequireFirebaseAuth(s, v)
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+				},
+				nil,
+			)
+			ServeStatic(s, "/", fstest.MapFS{"index.html": {Data: []byte("index")}}, SPAFallback())
+			require.NoError(t, s.mountDefaultEndpoints())
+
+			method := http.MethodGet
+			var body io.Reader
+			if tc.verified {
+				method = http.MethodPost
+				body = strings.NewReader("{}")
+			}
+			req := httptest.NewRequest(method, tc.path, body)
+			if tc.verified {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			res := httptest.NewRecorder()
+			s.mux.ServeHTTP(res, req)
+
+			require.Equal(t, tc.status, res.Code)
+			if tc.verified {
+				require.Equal(t, int32(1), v.calls.Load())
+			} else {
+				require.Zero(t, v.calls.Load())
+			}
+		})
+	}
+}
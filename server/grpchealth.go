@@ -0,0 +1,118 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/go-chi/chi/v5"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// grpcHealthWatchInterval is how often health is rechecked for clients watching
+// health status.
+const grpcHealthWatchInterval = 5 * time.Second
+
+var errUnknownService = errors.New("unknown service")
+
+// grpcHealthService implements the gRPC health protocol, grpc.health.v1.Health,
+// backed by the same health checks as /internal/health. Health checks are not scoped
+// to a service, so every service registered on the server reports the overall status of
+// the server and per-service status only distinguishes known from unknown services.
+type grpcHealthService struct {
+	s *Server
+}
+
+func (h *grpcHealthService) mount(mux *chi.Mux) {
+	svc := healthpb.File_grpc_health_v1_health_proto.Services().ByName("Health")
+	mux.Handle(healthpb.Health_Check_FullMethodName, connect.NewUnaryHandlerSimple(
+		healthpb.Health_Check_FullMethodName,
+		h.check,
+		connect.WithSchema(svc.Methods().ByName("Check")),
+	))
+	mux.Handle(healthpb.Health_List_FullMethodName, connect.NewUnaryHandlerSimple(
+		healthpb.Health_List_FullMethodName,
+		h.list,
+		connect.WithSchema(svc.Methods().ByName("List")),
+	))
+	mux.Handle(healthpb.Health_Watch_FullMethodName, connect.NewServerStreamHandlerSimple(
+		healthpb.Health_Watch_FullMethodName,
+		h.watch,
+		connect.WithSchema(svc.Methods().ByName("Watch")),
+	))
+}
+
+func (h *grpcHealthService) check(ctx context.Context, req *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+	status, err := h.status(ctx, req.GetService())
+	if err != nil {
+		return nil, connect.NewError(connect.CodeNotFound, err)
+	}
+	return &healthpb.HealthCheckResponse{Status: status}, nil
+}
+
+func (h *grpcHealthService) list(ctx context.Context, _ *healthpb.HealthListRequest) (*healthpb.HealthListResponse, error) {
+	status := h.serverStatus(ctx)
+	statuses := make(map[string]*healthpb.HealthCheckResponse, len(h.s.services)+1)
+	statuses[""] = &healthpb.HealthCheckResponse{Status: status}
+	for _, svc := range h.s.services {
+		statuses[svc] = &healthpb.HealthCheckResponse{Status: status}
+	}
+	return &healthpb.HealthListResponse{Statuses: statuses}, nil
+}
+
+func (h *grpcHealthService) watch(
+	ctx context.Context,
+	req *healthpb.HealthCheckRequest,
+	stream *connect.ServerStream[healthpb.HealthCheckResponse],
+) error {
+	ticker := time.NewTicker(grpcHealthWatchInterval)
+	defer ticker.Stop()
+
+	lastStatus := healthpb.HealthCheckResponse_UNKNOWN
+	for {
+		status, err := h.status(ctx, req.GetService())
+		if err != nil {
+			// The protocol requires Watch to report unknown services as a status
+			// rather than an error, as they may become known later.
+			status = healthpb.HealthCheckResponse_SERVICE_UNKNOWN
+		}
+		if status != lastStatus {
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: status}); err != nil {
+				return fmt.Errorf("server: sending health status: %w", err)
+			}
+			lastStatus = status
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-h.s.health.drainingCh:
+			// End the stream so it does not block the server from shutting down.
+			if lastStatus == healthpb.HealthCheckResponse_NOT_SERVING {
+				return nil
+			}
+			if err := stream.Send(&healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_NOT_SERVING}); err != nil {
+				return fmt.Errorf("server: sending health status: %w", err)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (h *grpcHealthService) status(ctx context.Context, service string) (healthpb.HealthCheckResponse_ServingStatus, error) {
+	if service != "" && !slices.Contains(h.s.services, service) {
+		return healthpb.HealthCheckResponse_SERVICE_UNKNOWN, fmt.Errorf("%w: %s", errUnknownService, service)
+	}
+	return h.serverStatus(ctx), nil
+}
+
+func (h *grpcHealthService) serverStatus(ctx context.Context) healthpb.HealthCheckResponse_ServingStatus {
+	if h.s.health.report(ctx).serving() {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
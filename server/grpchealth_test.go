@@ -0,0 +1,114 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestGRPCHealth(t *testing.T) {
+	tests := []struct {
+		name     string
+		service  string
+		healthy  bool
+		draining bool
+
+		status healthpb.HealthCheckResponse_ServingStatus
+		code   connect.Code
+	}{
+		{
+			name:    "server healthy",
+			service: "",
+			healthy: true,
+			status:  healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name:    "server unhealthy",
+			service: "",
+			healthy: false,
+			status:  healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+		{
+			name:    "service healthy",
+			service: "grpc.health.v1.Health",
+			healthy: true,
+			status:  healthpb.HealthCheckResponse_SERVING,
+		},
+		{
+			name:     "service draining",
+			service:  "grpc.health.v1.Health",
+			healthy:  true,
+			draining: true,
+			status:   healthpb.HealthCheckResponse_NOT_SERVING,
+		},
+		{
+			name:    "unknown service",
+			service: "curioswitch.test.UnknownService",
+			healthy: true,
+			code:    connect.CodeNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.services = append(s.services, "grpc.health.v1.Health")
+			AddHealthCheck(s, "test", func(context.Context) error {
+				if !tc.healthy {
+					return errUnhealthy
+				}
+				return nil
+			})
+			require.NoError(t, s.mountDefaultEndpoints())
+			if tc.draining {
+				s.health.startDraining()
+			}
+
+			srv := httptest.NewServer(s.mux)
+			defer srv.Close()
+
+			client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+				http.DefaultClient,
+				srv.URL+healthpb.Health_Check_FullMethodName,
+			)
+			res, err := client.CallUnary(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{Service: tc.service}))
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.status, res.Msg.GetStatus())
+		})
+	}
+}
+
+func TestGRPCHealthWatch(t *testing.T) {
+	s := newTestServer(t)
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		http.DefaultClient,
+		srv.URL+healthpb.Health_Watch_FullMethodName,
+	)
+	stream, err := client.CallServerStream(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+	require.NoError(t, err)
+	defer stream.Close()
+
+	require.True(t, stream.Receive())
+	require.Equal(t, healthpb.HealthCheckResponse_SERVING, stream.Msg().GetStatus())
+
+	s.health.startDraining()
+
+	require.True(t, stream.Receive())
+	require.Equal(t, healthpb.HealthCheckResponse_NOT_SERVING, stream.Msg().GetStatus())
+	require.False(t, stream.Receive())
+	require.NoError(t, stream.Err())
+}
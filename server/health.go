@@ -0,0 +1,176 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+var errHealthCheckTimeout = errors.New("health check timed out")
+
+const (
+	healthStatusServing    = "SERVING"
+	healthStatusNotServing = "NOT_SERVING"
+)
+
+// AddHealthCheck registers a health check with the given name. Health checks are
+// run when the readiness endpoint at /internal/health/ready is requested, and if any
+// returns an error, the server is reported as not ready to serve. Checks should be
+// relatively cheap, such as pinging a database, and should respect cancellation of ctx.
+// A check that does not complete within the configured timeout is reported as failed
+// and abandoned.
+//
+// The liveness endpoint at /internal/health/live does not run health checks and only
+// indicates that the server is able to respond to requests at all.
+func AddHealthCheck(s *Server, name string, check func(ctx context.Context) error) {
+	s.health.checks = append(s.health.checks, healthCheck{
+		name:  name,
+		check: check,
+	})
+}
+
+type healthCheck struct {
+	name  string
+	check func(ctx context.Context) error
+
+	// optional checks are reported but do not affect the overall status.
+	optional bool
+}
+
+type healthCheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type healthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]healthCheckResult `json:"checks,omitempty"`
+}
+
+func (r *healthReport) serving() bool {
+	return r.Status == healthStatusServing
+}
+
+type healthChecker struct {
+	conf   *config.Health
+	checks []healthCheck
+
+	// draining is set when the server has started shutting down, causing health checks
+	// to fail so load balancers stop routing new requests to it.
+	draining     atomic.Bool
+	drainingCh   chan struct{}
+	drainingOnce sync.Once
+
+	mu       sync.Mutex
+	cached   *healthReport
+	cachedAt time.Time
+}
+
+func newHealthChecker(conf *config.Health) *healthChecker {
+	return &healthChecker{
+		conf:       conf,
+		drainingCh: make(chan struct{}),
+	}
+}
+
+// startDraining marks the server as draining, causing all health checks to fail.
+func (h *healthChecker) startDraining() {
+	h.drainingOnce.Do(func() {
+		h.draining.Store(true)
+		close(h.drainingCh)
+	})
+}
+
+// report returns the result of running all health checks, reusing a recent result
+// if available.
+func (h *healthChecker) report(ctx context.Context) *healthReport {
+	if h.draining.Load() {
+		return &healthReport{Status: healthStatusNotServing}
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.cached != nil && time.Since(h.cachedAt) < h.conf.CacheDuration {
+		return h.cached
+	}
+
+	// Results are shared across requests so they should not be affected by
+	// cancellation of an individual one.
+	ctx = context.WithoutCancel(ctx)
+
+	results := make([]healthCheckResult, len(h.checks))
+	var wg sync.WaitGroup
+	for i, c := range h.checks {
+		wg.Go(func() {
+			if err := runHealthCheck(ctx, c, h.conf.Timeout); err != nil {
+				results[i] = healthCheckResult{Status: healthStatusNotServing, Error: err.Error()}
+			} else {
+				results[i] = healthCheckResult{Status: healthStatusServing}
+			}
+		})
+	}
+	wg.Wait()
+
+	report := &healthReport{Status: healthStatusServing}
+	if len(results) > 0 {
+		report.Checks = make(map[string]healthCheckResult, len(results))
+	}
+	for i, c := range h.checks {
+		report.Checks[c.name] = results[i]
+		if !c.optional && results[i].Status != healthStatusServing {
+			report.Status = healthStatusNotServing
+		}
+	}
+
+	h.cached = report
+	h.cachedAt = time.Now()
+	return report
+}
+
+// runHealthCheck runs the check with the given timeout. If the check does not respect
+// cancellation of its context, it is abandoned after the timeout.
+func runHealthCheck(ctx context.Context, c healthCheck, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, errHealthCheckTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- c.check(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil && ctx.Err() != nil {
+			// Report cancellation errors returned by checks consistently with abandoned ones.
+			return context.Cause(ctx)
+		}
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
+
+func (h *healthChecker) handleLive(w http.ResponseWriter, _ *http.Request) {
+	writeHealthReport(w, &healthReport{Status: healthStatusServing})
+}
+
+func (h *healthChecker) handleReady(w http.ResponseWriter, r *http.Request) {
+	writeHealthReport(w, h.report(r.Context()))
+}
+
+func writeHealthReport(w http.ResponseWriter, report *healthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	if report.serving() {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errUnhealthy = errors.New("unhealthy")
+
+func TestHealth(t *testing.T) {
+	// Released after the test so the abandoned hanging check does not leak.
+	release := make(chan struct{})
+	t.Cleanup(func() { close(release) })
+
+	tests := []struct {
+		name     string
+		checks   map[string]func(ctx context.Context) error
+		draining bool
+
+		liveStatus   int
+		readyStatus  int
+		readyReport  healthReport
+		legacyStatus int
+	}{
+		{
+			name:         "no checks",
+			liveStatus:   http.StatusOK,
+			readyStatus:  http.StatusOK,
+			readyReport:  healthReport{Status: healthStatusServing},
+			legacyStatus: http.StatusOK,
+		},
+		{
+			name: "healthy checks",
+			checks: map[string]func(ctx context.Context) error{
+				"db":    func(context.Context) error { return nil },
+				"cache": func(context.Context) error { return nil },
+			},
+			liveStatus:  http.StatusOK,
+			readyStatus: http.StatusOK,
+			readyReport: healthReport{
+				Status: healthStatusServing,
+				Checks: map[string]healthCheckResult{
+					"db":    {Status: healthStatusServing},
+					"cache": {Status: healthStatusServing},
+				},
+			},
+			legacyStatus: http.StatusOK,
+		},
+		{
+			name: "failing check",
+			checks: map[string]func(ctx context.Context) error{
+				"db":    func(context.Context) error { return errUnhealthy },
+				"cache": func(context.Context) error { return nil },
+			},
+			liveStatus:  http.StatusOK,
+			readyStatus: http.StatusServiceUnavailable,
+			readyReport: healthReport{
+				Status: healthStatusNotServing,
+				Checks: map[string]healthCheckResult{
+					"db":    {Status: healthStatusNotServing, Error: "unhealthy"},
+					"cache": {Status: healthStatusServing},
+				},
+			},
+			legacyStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "timed out check",
+			checks: map[string]func(ctx context.Context) error{
+				"slow": func(ctx context.Context) error {
+					<-ctx.Done()
+					return ctx.Err()
+				},
+			},
+			liveStatus:  http.StatusOK,
+			readyStatus: http.StatusServiceUnavailable,
+			readyReport: healthReport{
+				Status: healthStatusNotServing,
+				Checks: map[string]healthCheckResult{
+					"slow": {Status: healthStatusNotServing, Error: "health check timed out"},
+				},
+			},
+			legacyStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "hanging check",
+			checks: map[string]func(ctx context.Context) error{
+				"hanging": func(context.Context) error {
+					// Ignores cancellation of ctx.
+					<-release
+					return nil
+				},
+			},
+			liveStatus:  http.StatusOK,
+			readyStatus: http.StatusServiceUnavailable,
+			readyReport: healthReport{
+				Status: healthStatusNotServing,
+				Checks: map[string]healthCheckResult{
+					"hanging": {Status: healthStatusNotServing, Error: "health check timed out"},
+				},
+			},
+			legacyStatus: http.StatusServiceUnavailable,
+		},
+		{
+			name: "draining",
+			checks: map[string]func(ctx context.Context) error{
+				"db": func(context.Context) error { return nil },
+			},
+			draining:     true,
+			liveStatus:   http.StatusOK,
+			readyStatus:  http.StatusServiceUnavailable,
+			readyReport:  healthReport{Status: healthStatusNotServing},
+			legacyStatus: http.StatusServiceUnavailable,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.Health.Timeout = 10 * time.Millisecond
+			for name, check := range tc.checks {
+				AddHealthCheck(s, name, check)
+			}
+			require.NoError(t, s.mountDefaultEndpoints())
+			if tc.draining {
+				s.health.startDraining()
+			}
+
+			res := serveTestRequest(s, http.MethodGet, "/internal/health/live")
+			require.Equal(t, tc.liveStatus, res.Code)
+
+			res = serveTestRequest(s, http.MethodGet, "/internal/health/ready")
+			require.Equal(t, tc.readyStatus, res.Code)
+			var report healthReport
+			require.NoError(t, json.Unmarshal(res.Body.Bytes(), &report))
+			require.Equal(t, tc.readyReport, report)
+
+			res = serveTestRequest(s, http.MethodGet, "/internal/health")
+			require.Equal(t, tc.legacyStatus, res.Code)
+		})
+	}
+}
+
+func TestHealthCached(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Health.CacheDuration = time.Hour
+
+	calls := 0
+	AddHealthCheck(s, "counter", func(context.Context) error {
+		calls++
+		return nil
+	})
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	for range 3 {
+		res := serveTestRequest(s, http.MethodGet, "/internal/health/ready")
+		require.Equal(t, http.StatusOK, res.Code)
+	}
+	require.Equal(t, 1, calls)
+}
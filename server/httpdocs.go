@@ -0,0 +1,193 @@
+package server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/curioswitch/go-docs-handler/specification"
+)
+
+// httpDocsService is the name of the service listing HTTP routes in the docs handler.
+const httpDocsService = "HTTP"
+
+// HTTPRouteDocsOption is a configuration option for documenting an HTTP route with
+// HandleHTTP or DocumentHTTPRoute.
+type HTTPRouteDocsOption interface {
+	apply(r *httpRouteDocs)
+}
+
+// RouteDescription returns a HTTPRouteDocsOption to describe the route in the docs.
+func RouteDescription(description string) HTTPRouteDocsOption {
+	return routeDescriptionOption(description)
+}
+
+type routeDescriptionOption string
+
+func (o routeDescriptionOption) apply(r *httpRouteDocs) {
+	r.description = string(o)
+}
+
+// RouteContentType returns a HTTPRouteDocsOption to set the content type of request
+// bodies sent from the docs, such as "application/x-www-form-urlencoded". By default,
+// "application/json" is used.
+func RouteContentType(contentType string) HTTPRouteDocsOption {
+	return routeContentTypeOption(contentType)
+}
+
+type routeContentTypeOption string
+
+func (o routeContentTypeOption) apply(r *httpRouteDocs) {
+	r.contentType = string(o)
+}
+
+// RouteExampleRequest returns a HTTPRouteDocsOption to add an example request body to
+// the docs. It can be passed multiple times to add multiple examples.
+func RouteExampleRequest(body string) HTTPRouteDocsOption {
+	return routeExampleRequestOption(body)
+}
+
+type routeExampleRequestOption string
+
+func (o routeExampleRequestOption) apply(r *httpRouteDocs) {
+	r.exampleRequests = append(r.exampleRequests, string(o))
+}
+
+// RouteExampleHeaders returns a HTTPRouteDocsOption to add example request headers to
+// the docs, such as a signature expected by a webhook. It can be passed multiple times
+// to add multiple examples.
+func RouteExampleHeaders(headers map[string]string) HTTPRouteDocsOption {
+	return routeExampleHeadersOption(headers)
+}
+
+type routeExampleHeadersOption map[string]string
+
+func (o routeExampleHeadersOption) apply(r *httpRouteDocs) {
+	r.exampleHeaders = append(r.exampleHeaders, o)
+}
+
+// HandleHTTP registers h for requests with the HTTP method, such as http.MethodPost, to
+// pattern on the server's Mux and documents the route in the docs handler. It is the
+// same as calling Mux(s).Method and DocumentHTTPRoute, and is generally used for routes
+// that cannot be connect procedures, such as webhooks, uploads or OAuth callbacks.
+func HandleHTTP(s *Server, method string, pattern string, h http.Handler, opts ...HTTPRouteDocsOption) {
+	s.mux.Method(method, pattern, h)
+	DocumentHTTPRoute(s, method, pattern, opts...)
+}
+
+// DocumentHTTPRoute documents a route registered on the server's Mux for requests with
+// the HTTP method to pattern in the docs handler, where it can also be sent requests.
+// pattern is the full chi route pattern, including any prefix of sub-routers, and its URL
+// parameters are documented as path parameters.
+func DocumentHTTPRoute(s *Server, method string, pattern string, opts ...HTTPRouteDocsOption) {
+	if !strings.HasPrefix(pattern, "/") {
+		panic("pattern must begin with '/'")
+	}
+
+	r := &httpRouteDocs{
+		method:      strings.ToUpper(method),
+		contentType: "application/json",
+	}
+	r.path, r.params = chiDocsPath(pattern)
+	for _, o := range opts {
+		o.apply(r)
+	}
+	s.httpRoutes = append(s.httpRoutes, r)
+}
+
+// httpRouteDocs is the documentation of a route registered on the server's Mux.
+type httpRouteDocs struct {
+	method string
+	// path is the route pattern with regular expressions of URL parameters removed.
+	path   string
+	params []string
+
+	description     string
+	contentType     string
+	exampleRequests []string
+	exampleHeaders  []map[string]string
+}
+
+// chiDocsPath returns pattern with regular expressions of URL parameters removed, for
+// display in docs, along with the names of the parameters.
+func chiDocsPath(pattern string) (string, []string) {
+	var path strings.Builder
+	var params []string
+	for {
+		start := strings.IndexByte(pattern, '{')
+		if start < 0 {
+			path.WriteString(pattern)
+			break
+		}
+		path.WriteString(pattern[:start])
+
+		// Regular expressions may contain braces, such as {id:[0-9]{4}}.
+		depth := 0
+		end := len(pattern)
+	scan:
+		for i := start; i < len(pattern); i++ {
+			switch pattern[i] {
+			case '{':
+				depth++
+			case '}':
+				depth--
+				if depth == 0 {
+					end = i
+					break scan
+				}
+			}
+		}
+
+		name, _, _ := strings.Cut(pattern[start+1:end], ":")
+		params = append(params, name)
+		path.WriteString("{" + name + "}")
+		pattern = pattern[min(end+1, len(pattern)):]
+	}
+	return path.String(), params
+}
+
+// httpDocsPlugin is a docs handler plugin that documents routes registered on the
+// server's Mux with DocumentHTTPRoute.
+type httpDocsPlugin struct {
+	routes []*httpRouteDocs
+}
+
+func (p *httpDocsPlugin) GenerateSpecification() (*specification.Specification, error) {
+	svc := specification.Service{
+		Name:            httpDocsService,
+		DescriptionInfo: specification.DescriptionInfo{Markup: "NONE"},
+	}
+
+	for _, r := range p.routes {
+		params := make([]specification.Field, len(r.params))
+		for i, name := range r.params {
+			params[i] = specification.Field{
+				Name:            name,
+				Location:        specification.FieldLocationPath,
+				Requirement:     "REQUIRED",
+				TypeSignature:   baseTypeSignature("string"),
+				DescriptionInfo: specification.DescriptionInfo{Markup: "NONE"},
+			}
+		}
+
+		svc.Methods = append(svc.Methods, specification.Method{
+			Name:                r.path,
+			ID:                  httpDocsService + r.path + "/" + r.method,
+			ReturnTypeSignature: baseTypeSignature("bytes"),
+			Parameters:          params,
+			Endpoints: []specification.Endpoint{
+				{
+					HostnamePattern:    "*",
+					PathMapping:        r.path,
+					DefaultMimeType:    r.contentType,
+					AvailableMimeTypes: []string{r.contentType},
+				},
+			},
+			ExampleHeaders:  r.exampleHeaders,
+			ExampleRequests: r.exampleRequests,
+			HTTPMethod:      r.method,
+			DescriptionInfo: specification.DescriptionInfo{DocString: r.description, Markup: "NONE"},
+		})
+	}
+
+	return &specification.Specification{Services: []specification.Service{svc}}, nil
+}
@@ -0,0 +1,113 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestChiDocsPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+
+		path   string
+		params []string
+	}{
+		{
+			pattern: "/webhooks/stripe",
+			path:    "/webhooks/stripe",
+		},
+		{
+			pattern: "/webhooks/{provider}",
+			path:    "/webhooks/{provider}",
+			params:  []string{"provider"},
+		},
+		{
+			pattern: "/uploads/{id:[0-9]{4}}/{name}.png",
+			path:    "/uploads/{id}/{name}.png",
+			params:  []string{"id", "name"},
+		},
+		{
+			pattern: "/files/*",
+			path:    "/files/*",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.pattern, func(t *testing.T) {
+			path, params := chiDocsPath(tc.pattern)
+			require.Equal(t, tc.path, path)
+			require.Equal(t, tc.params, params)
+		})
+	}
+}
+
+func TestHTTPRouteDocs(t *testing.T) {
+	s := newTestServer(t)
+	HandleHTTP(s, http.MethodPost, "/webhooks/{provider:[a-z]+}",
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}),
+		RouteDescription("Receives webhooks."),
+		RouteExampleRequest(`{"event": "created"}`),
+		RouteExampleHeaders(map[string]string{"X-Signature": "sig"}),
+	)
+	s.mux.Get("/oauth/callback", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	DocumentHTTPRoute(s, "get", "/oauth/callback", RouteContentType("text/plain"))
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	res := serveTestRequest(s, http.MethodPost, "/webhooks/stripe")
+	require.Equal(t, http.StatusAccepted, res.Code)
+
+	res = serveTestRequest(s, http.MethodGet, "/internal/docs/specification.json")
+	require.Equal(t, http.StatusOK, res.Code)
+
+	var spec struct {
+		Services []struct {
+			Name    string `json:"name"`
+			Methods []struct {
+				Name       string `json:"name"`
+				HTTPMethod string `json:"httpMethod"`
+				Parameters []struct {
+					Name     string `json:"name"`
+					Location string `json:"location"`
+				} `json:"parameters"`
+				Endpoints []struct {
+					PathMapping     string `json:"pathMapping"`
+					DefaultMimeType string `json:"defaultMimeType"`
+				} `json:"endpoints"`
+				ExampleRequests []string            `json:"exampleRequests"`
+				ExampleHeaders  []map[string]string `json:"exampleHeaders"`
+				DescriptionInfo struct {
+					DocString string `json:"docString"`
+				} `json:"descriptionInfo"`
+			} `json:"methods"`
+		} `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &spec))
+	require.Len(t, spec.Services, 1)
+	require.Equal(t, httpDocsService, spec.Services[0].Name)
+
+	methods := spec.Services[0].Methods
+	require.Len(t, methods, 2)
+
+	require.Equal(t, "/webhooks/{provider}", methods[0].Name)
+	require.Equal(t, http.MethodPost, methods[0].HTTPMethod)
+	require.Len(t, methods[0].Parameters, 1)
+	require.Equal(t, "provider", methods[0].Parameters[0].Name)
+	require.Equal(t, "PATH", methods[0].Parameters[0].Location)
+	require.Equal(t, "/webhooks/{provider}", methods[0].Endpoints[0].PathMapping)
+	require.Equal(t, "application/json", methods[0].Endpoints[0].DefaultMimeType)
+	require.Equal(t, []string{`{"event": "created"}`}, methods[0].ExampleRequests)
+	require.Equal(t, []map[string]string{{"X-Signature": "sig"}}, methods[0].ExampleHeaders)
+	require.Equal(t, "Receives webhooks.", methods[0].DescriptionInfo.DocString)
+
+	require.Equal(t, "/oauth/callback", methods[1].Name)
+	require.Equal(t, http.MethodGet, methods[1].HTTPMethod)
+	require.Empty(t, methods[1].Parameters)
+	require.Equal(t, "text/plain", methods[1].Endpoints[0].DefaultMimeType)
+}
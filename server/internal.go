@@ -0,0 +1,213 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+var errMissingInternalPassword = errors.New("basic auth password for internal endpoints is empty")
+
+// internalGuard protects /internal/ endpoints as configured in config.Internal.
+type internalGuard struct {
+	s    *Server
+	conf *config.Internal
+
+	allowedIPs []netip.Prefix
+}
+
+func newInternalGuard(s *Server, conf *config.Internal) (*internalGuard, error) {
+	if conf.BasicAuth.Username != "" && conf.BasicAuth.Password == "" {
+		return nil, fmt.Errorf("server: %w", errMissingInternalPassword)
+	}
+
+	g := &internalGuard{s: s, conf: conf}
+	for _, ip := range conf.AllowedIPs {
+		prefix, err := parseIPPrefix(ip)
+		if err != nil {
+			return nil, err
+		}
+		g.allowedIPs = append(g.allowedIPs, prefix)
+	}
+	return g, nil
+}
+
+// parseIPPrefix parses a CIDR range, or a single IP address as a range with only it.
+func parseIPPrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("server: parsing allowed IP for internal endpoints: %w", err)
+		}
+		return p.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("server: parsing allowed IP for internal endpoints: %w", err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// protectInternal is middleware that enforces the internalGuard of the server on
+// /internal/ endpoints other than health checks.
+func (b *Server) protectInternal(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		g := b.internalGuard
+		if g == nil || !strings.HasPrefix(r.URL.Path, "/internal/") || isHealthPath(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ip := clientIP(r, g.conf.TrustedProxies)
+		status := g.check(r, ip)
+		if g.conf.LogAccess {
+			// Requests to /internal/ endpoints are not in the request log, so access is
+			// logged separately.
+			level := slog.LevelInfo
+			if status != http.StatusOK {
+				level = slog.LevelWarn
+			}
+			slog.Log(r.Context(), level, fmt.Sprintf("Request to internal endpoint %s", r.URL.Path),
+				"client_ip", ip.String(), "status", status)
+		}
+
+		switch status {
+		case http.StatusOK:
+			next.ServeHTTP(w, r)
+		case http.StatusUnauthorized:
+			if g.conf.BasicAuth.Username != "" {
+				w.Header().Set("WWW-Authenticate", `Basic realm="internal", charset="UTF-8"`)
+			}
+			http.Error(w, http.StatusText(status), status)
+		default:
+			http.Error(w, http.StatusText(status), status)
+		}
+	})
+}
+
+func isHealthPath(p string) bool {
+	return p == "/internal/health" || strings.HasPrefix(p, "/internal/health/")
+}
+
+// check returns the HTTP status for a request to an internal endpoint from ip, which is
+// http.StatusOK if it is allowed.
+func (g *internalGuard) check(r *http.Request, ip netip.Addr) int {
+	if len(g.allowedIPs) > 0 && !slices.ContainsFunc(g.allowedIPs, func(p netip.Prefix) bool {
+		return p.Contains(ip)
+	}) {
+		return http.StatusForbidden
+	}
+
+	basic := g.conf.BasicAuth.Username != ""
+	if !basic && !g.conf.RequireIdentity {
+		return http.StatusOK
+	}
+	if basic && g.checkBasicAuth(r) {
+		return http.StatusOK
+	}
+	if g.conf.RequireIdentity && g.checkIdentity(r) {
+		return http.StatusOK
+	}
+	return http.StatusUnauthorized
+}
+
+func (g *internalGuard) checkBasicAuth(r *http.Request) bool {
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	// Both are always compared to not leak which is incorrect through timing.
+	usernameOK := subtle.ConstantTimeCompare([]byte(username), []byte(g.conf.BasicAuth.Username)) == 1
+	passwordOK := subtle.ConstantTimeCompare([]byte(password), []byte(g.conf.BasicAuth.Password)) == 1
+	return usernameOK && passwordOK
+}
+
+// checkIdentity returns whether the request has a bearer token verified by the server's
+// JWT or Firebase auth, for an allowed identity.
+func (g *internalGuard) checkIdentity(r *http.Request) bool {
+	token, ok := bearerTokenFromHeader(r.Header)
+	if !ok {
+		return false
+	}
+
+	var parsed *parsedJWT
+	if g.s.jwtAuth != nil {
+		parsed = g.s.jwtAuth.parse(token)
+	}
+
+	var identities []string
+	switch {
+	case parsed != nil:
+		p, err := g.s.jwtAuth.verify(r.Context(), parsed)
+		if err != nil {
+			return false
+		}
+		identities = append(identities, p.Subject)
+		if email, ok := verifiedEmail(p.Claims); ok {
+			identities = append(identities, email)
+		}
+	case g.s.firebaseAuth != nil:
+		t, err := g.s.firebaseAuth.verify(r.Context(), token)
+		if err != nil {
+			return false
+		}
+		identities = append(identities, t.UID)
+		if email, ok := verifiedEmail(t.Claims); ok {
+			identities = append(identities, email)
+		}
+	default:
+		return false
+	}
+
+	if len(g.conf.AllowedIdentities) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(identities, func(id string) bool {
+		return id != "" && slices.Contains(g.conf.AllowedIdentities, id)
+	})
+}
+
+// verifiedEmail returns the email claim of a token, with ok false if it is missing or
+// not verified by the issuer, since an unverified email may belong to anyone.
+func verifiedEmail(claims map[string]any) (email string, ok bool) {
+	if verified, _ := claims["email_verified"].(bool); !verified {
+		return "", false
+	}
+	email, ok = claims["email"].(string)
+	return email, ok
+}
+
+// clientIP returns the address of the client of the request. If there are trusted
+// proxies, it is read from X-Forwarded-For, where the last proxy appended it.
+func clientIP(r *http.Request, trustedProxies int) netip.Addr {
+	if trustedProxies > 0 {
+		var forwarded []string
+		for _, v := range r.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, strings.Split(v, ",")...)
+		}
+		if len(forwarded) >= trustedProxies {
+			if addr, err := netip.ParseAddr(strings.TrimSpace(forwarded[len(forwarded)-trustedProxies])); err == nil {
+				return addr.Unmap()
+			}
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
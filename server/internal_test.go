@@ -0,0 +1,254 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/config"
+	"github.com/curioswitch/go-curiostack/testutil"
+)
+
+func TestProtectInternal(t *testing.T) {
+	stub := testutil.NewFirebaseAuthStub(t, "test-project")
+
+	token := func(uid string, claims map[string]any) string {
+		t.Helper()
+		tok, err := stub.IDToken(uid, "", claims)
+		require.NoError(t, err)
+		return "Bearer " + tok
+	}
+
+	tests := []struct {
+		name          string
+		conf          config.Internal
+		path          string
+		remoteAddr    string
+		forwardedFor  string
+		basicAuth     []string
+		authorization string
+
+		status int
+	}{
+		{
+			name:   "unprotected",
+			path:   "/internal/secret",
+			status: http.StatusOK,
+		},
+		{
+			name:       "allowed ip",
+			conf:       config.Internal{AllowedIPs: []string{"10.0.0.0/8"}},
+			path:       "/internal/secret",
+			remoteAddr: "10.1.2.3:1234",
+			status:     http.StatusOK,
+		},
+		{
+			name:       "allowed single ip",
+			conf:       config.Internal{AllowedIPs: []string{"192.0.2.1"}},
+			path:       "/internal/secret",
+			remoteAddr: "192.0.2.1:1234",
+			status:     http.StatusOK,
+		},
+		{
+			name:       "disallowed ip",
+			conf:       config.Internal{AllowedIPs: []string{"10.0.0.0/8"}},
+			path:       "/internal/secret",
+			remoteAddr: "192.0.2.1:1234",
+			status:     http.StatusForbidden,
+		},
+		{
+			name:         "forwarded ip ignored without trusted proxies",
+			conf:         config.Internal{AllowedIPs: []string{"10.0.0.0/8"}},
+			path:         "/internal/secret",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: "10.1.2.3",
+			status:       http.StatusForbidden,
+		},
+		{
+			name:         "forwarded ip from trusted proxy",
+			conf:         config.Internal{AllowedIPs: []string{"10.0.0.0/8"}, TrustedProxies: 1},
+			path:         "/internal/secret",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: "192.0.2.2, 10.1.2.3",
+			status:       http.StatusOK,
+		},
+		{
+			name:         "spoofed forwarded ip",
+			conf:         config.Internal{AllowedIPs: []string{"10.0.0.0/8"}, TrustedProxies: 1},
+			path:         "/internal/secret",
+			remoteAddr:   "192.0.2.1:1234",
+			forwardedFor: "10.1.2.3, 192.0.2.2",
+			status:       http.StatusForbidden,
+		},
+		{
+			name:       "health not protected",
+			conf:       config.Internal{AllowedIPs: []string{"10.0.0.0/8"}},
+			path:       "/internal/health/ready",
+			remoteAddr: "192.0.2.1:1234",
+			status:     http.StatusOK,
+		},
+		{
+			name:   "basic auth missing",
+			conf:   config.Internal{BasicAuth: config.BasicAuth{Username: "admin", Password: "secret"}},
+			path:   "/internal/secret",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:      "basic auth wrong password",
+			conf:      config.Internal{BasicAuth: config.BasicAuth{Username: "admin", Password: "secret"}},
+			path:      "/internal/secret",
+			basicAuth: []string{"admin", "wrong"},
+			status:    http.StatusUnauthorized,
+		},
+		{
+			name:      "basic auth",
+			conf:      config.Internal{BasicAuth: config.BasicAuth{Username: "admin", Password: "secret"}},
+			path:      "/internal/secret",
+			basicAuth: []string{"admin", "secret"},
+			status:    http.StatusOK,
+		},
+		{
+			name:   "identity missing",
+			conf:   config.Internal{RequireIdentity: true},
+			path:   "/internal/secret",
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:          "identity invalid",
+			conf:          config.Internal{RequireIdentity: true},
+			path:          "/internal/secret",
+			authorization: "Bearer invalid",
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "identity",
+			conf:          config.Internal{RequireIdentity: true},
+			path:          "/internal/secret",
+			authorization: token("user", nil),
+			status:        http.StatusOK,
+		},
+		{
+			name:          "identity allowed by email",
+			conf:          config.Internal{RequireIdentity: true, AllowedIdentities: []string{"admin@example.com"}},
+			path:          "/internal/secret",
+			authorization: token("user", map[string]any{"email": "admin@example.com", "email_verified": true}),
+			status:        http.StatusOK,
+		},
+		{
+			name:          "identity unverified email",
+			conf:          config.Internal{RequireIdentity: true, AllowedIdentities: []string{"admin@example.com"}},
+			path:          "/internal/secret",
+			authorization: token("user", map[string]any{"email": "admin@example.com", "email_verified": false}),
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "identity email without verified claim",
+			conf:          config.Internal{RequireIdentity: true, AllowedIdentities: []string{"admin@example.com"}},
+			path:          "/internal/secret",
+			authorization: token("user", map[string]any{"email": "admin@example.com"}),
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name:          "identity not allowed",
+			conf:          config.Internal{RequireIdentity: true, AllowedIdentities: []string{"admin"}},
+			path:          "/internal/secret",
+			authorization: token("user", nil),
+			status:        http.StatusUnauthorized,
+		},
+		{
+			name: "basic auth or identity",
+			conf: config.Internal{
+				BasicAuth:       config.BasicAuth{Username: "admin", Password: "secret"},
+				RequireIdentity: true,
+			},
+			path:          "/internal/secret",
+			authorization: token("user", nil),
+			status:        http.StatusOK,
+		},
+		{
+			name:       "ip checked before auth",
+			conf:       config.Internal{AllowedIPs: []string{"10.0.0.0/8"}, BasicAuth: config.BasicAuth{Username: "admin", Password: "secret"}},
+			path:       "/internal/secret",
+			remoteAddr: "192.0.2.1:1234",
+			basicAuth:  []string{"admin", "secret"},
+			status:     http.StatusForbidden,
+		},
+		{
+			name:   "docs enabled",
+			path:   "/internal/openapi.json",
+			status: http.StatusOK,
+		},
+		{
+			name:   "docs disabled",
+			conf:   config.Internal{DisableDocs: true},
+			path:   "/internal/openapi.json",
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "public route not protected",
+			conf:   config.Internal{AllowedIPs: []string{"10.0.0.0/8"}, RequireIdentity: true},
+			path:   "/public",
+			status: http.StatusOK,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.Internal = tc.conf
+			s.conf.Server.Internal.LogAccess = true
+			RequireFirebaseAuth(s, stub)
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{}, nil
+				},
+				nil,
+				SkipFirebaseAuth(),
+			)
+			ok := func(w http.ResponseWriter, _ *http.Request) {
+				w.WriteHeader(http.StatusOK)
+			}
+			s.mux.Get("/internal/secret", ok)
+			s.mux.Get("/public", ok)
+			require.NoError(t, s.mountDefaultEndpoints())
+
+			req := httptest.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.remoteAddr != "" {
+				req.RemoteAddr = tc.remoteAddr
+			}
+			if tc.forwardedFor != "" {
+				req.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+			if tc.basicAuth != nil {
+				req.SetBasicAuth(tc.basicAuth[0], tc.basicAuth[1])
+			}
+			if tc.authorization != "" {
+				req.Header.Set("Authorization", tc.authorization)
+			}
+			res := httptest.NewRecorder()
+			s.mux.ServeHTTP(res, req)
+
+			require.Equal(t, tc.status, res.Code)
+			if tc.status == http.StatusUnauthorized && tc.conf.BasicAuth.Username != "" {
+				require.NotEmpty(t, res.Header().Get("WWW-Authenticate"))
+			}
+		})
+	}
+}
+
+func TestProtectInternalInvalidIP(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Internal.AllowedIPs = []string{"10.0.0.0/33"}
+	require.Error(t, s.mountDefaultEndpoints())
+}
+
+func TestProtectInternalEmptyPassword(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Internal.BasicAuth.Username = "admin"
+	require.ErrorIs(t, s.mountDefaultEndpoints(), errMissingInternalPassword)
+}
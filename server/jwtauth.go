@@ -0,0 +1,438 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	"github.com/curioswitch/go-curiostack/config"
+	authv1 "github.com/curioswitch/go-curiostack/proto/curiostack/auth/v1"
+)
+
+const (
+	// jwksRefreshInterval is how long a fetched key set is used before fetching again.
+	jwksRefreshInterval = time.Hour
+	// jwksMinRefreshInterval is the minimum time between fetching a key set when
+	// encountering an unknown key ID or after a failed fetch, to prevent abuse and
+	// avoid overloading an unavailable issuer.
+	jwksMinRefreshInterval = time.Minute
+)
+
+var (
+	errUnknownKey        = errors.New("unknown signing key")
+	errNoAudiences       = errors.New("no audiences configured for issuer")
+	errJWKSFetch         = errors.New("failed to fetch key set")
+	errJWTAuthNotEnabled = errors.New("procedure requires authentication but no issuers are configured")
+	errMissingRole       = errors.New("caller does not have a required role")
+	errMissingClaim      = errors.New("caller does not have a required claim")
+)
+
+var jwtSignatureAlgorithms = []jose.SignatureAlgorithm{
+	jose.RS256, jose.RS384, jose.RS512,
+	jose.PS256, jose.PS384, jose.PS512,
+	jose.ES256, jose.ES384, jose.ES512,
+	jose.EdDSA,
+}
+
+// Principal is the caller of a request, authenticated with a JWT from a configured
+// issuer.
+type Principal struct {
+	// Issuer is the issuer of the caller's token.
+	Issuer string
+
+	// Subject is the subject of the caller's token, generally an ID for the caller.
+	Subject string
+
+	// Roles are the roles of the caller, read from the issuer's configured roles claim.
+	Roles []string
+
+	// Claims are all the claims of the caller's token.
+	Claims map[string]any
+}
+
+// JWTPrincipal returns the caller of the request authenticated with a JWT from a
+// configured issuer, or nil if the request is not authenticated with one.
+func JWTPrincipal(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+type principalKey struct{}
+
+// jwtAuth verifies JWTs from the issuers in config.Auth.
+type jwtAuth struct {
+	issuers map[string]*jwtIssuer
+}
+
+func newJWTAuth(conf *config.Auth) *jwtAuth {
+	if len(conf.Issuers) == 0 {
+		return nil
+	}
+
+	a := &jwtAuth{issuers: make(map[string]*jwtIssuer, len(conf.Issuers))}
+	for i := range conf.Issuers {
+		c := &conf.Issuers[i]
+		a.issuers[c.Issuer] = &jwtIssuer{conf: c}
+	}
+	return a
+}
+
+// parsedJWT is a JWT from a configured issuer that has been parsed but not verified.
+type parsedJWT struct {
+	tok *jwt.JSONWebToken
+	iss *jwtIssuer
+}
+
+type parsedJWTKey struct{}
+
+// parse parses the token, returning nil if it is not a JWT from a configured issuer.
+// The token is not verified.
+func (a *jwtAuth) parse(raw string) *parsedJWT {
+	tok, err := jwt.ParseSigned(raw, jwtSignatureAlgorithms)
+	if err != nil {
+		return nil
+	}
+	var claims jwt.Claims
+	if err := tok.UnsafeClaimsWithoutVerification(&claims); err != nil {
+		return nil
+	}
+	iss, ok := a.issuers[claims.Issuer]
+	if !ok {
+		return nil
+	}
+	return &parsedJWT{tok: tok, iss: iss}
+}
+
+// parseRequest returns the bearer token of the request parsed with parse, reusing the
+// result of verifyFirebaseToken if it already parsed it.
+func (a *jwtAuth) parseRequest(ctx context.Context, header http.Header) *parsedJWT {
+	if t, ok := ctx.Value(parsedJWTKey{}).(*parsedJWT); ok {
+		return t
+	}
+	raw, ok := bearerTokenFromHeader(header)
+	if !ok {
+		return nil
+	}
+	return a.parse(raw)
+}
+
+func (a *jwtAuth) verify(ctx context.Context, t *parsedJWT) (*Principal, error) {
+	iss := t.iss
+	if len(iss.conf.Audiences) == 0 {
+		return nil, fmt.Errorf("%w: %s", errNoAudiences, iss.conf.Issuer)
+	}
+
+	var kid string
+	if len(t.tok.Headers) > 0 {
+		kid = t.tok.Headers[0].KeyID
+	}
+	key, err := iss.key(ctx, kid)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var all map[string]any
+	if err := t.tok.Claims(key, &claims, &all); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+	if err := claims.ValidateWithLeeway(jwt.Expected{
+		Issuer:      iss.conf.Issuer,
+		AnyAudience: iss.conf.Audiences,
+		Time:        time.Now(),
+	}, jwt.DefaultLeeway); err != nil {
+		return nil, fmt.Errorf("%w: %w", errInvalidToken, err)
+	}
+
+	rolesClaim := iss.conf.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+
+	return &Principal{
+		Issuer:  claims.Issuer,
+		Subject: claims.Subject,
+		Roles:   claimStrings(all[rolesClaim]),
+		Claims:  all,
+	}, nil
+}
+
+// jwtIssuer caches the key set of an issuer.
+type jwtIssuer struct {
+	conf *config.Issuer
+
+	// fetchMu is held while fetching the key set, so only one request fetches it at a
+	// time without blocking requests for keys already in the cache.
+	fetchMu sync.Mutex
+
+	mu        sync.Mutex
+	keys      *jose.JSONWebKeySet
+	fetchedAt time.Time
+	// attemptedAt is the time of the last fetch of the key set, successful or not, to
+	// throttle fetches.
+	attemptedAt time.Time
+	fetchErr    error
+}
+
+func (i *jwtIssuer) key(ctx context.Context, kid string) (*jose.JSONWebKey, error) {
+	if k, ok, err := i.cachedKey(kid); ok {
+		return k, err
+	}
+
+	i.fetchMu.Lock()
+	defer i.fetchMu.Unlock()
+
+	// The key set may have been fetched by another request while waiting.
+	if k, ok, err := i.cachedKey(kid); ok {
+		return k, err
+	}
+
+	fetched, err := i.fetchKeys(ctx)
+
+	i.mu.Lock()
+	if err == nil || ctx.Err() == nil {
+		// Cancellation of the request is not a failure of the issuer.
+		i.attemptedAt = time.Now()
+		i.fetchErr = err
+	}
+	if err == nil {
+		i.keys = fetched
+		i.fetchedAt = i.attemptedAt
+	}
+	keys := i.keys
+	i.mu.Unlock()
+
+	var k *jose.JSONWebKey
+	if keys != nil {
+		k = findKey(keys, kid)
+	}
+	switch {
+	case k != nil:
+		if err != nil {
+			// Keep using the cached key set while the issuer is unavailable.
+			slog.WarnContext(ctx, "Failed to refresh key set, using cached keys", "issuer", i.conf.Issuer, "error", err)
+		}
+		return k, nil
+	case err != nil:
+		return nil, err
+	default:
+		return nil, fmt.Errorf("%w: %q", errUnknownKey, kid)
+	}
+}
+
+// cachedKey returns the key from the cached key set, with ok false if the key set needs
+// to be fetched to find it. Keys from a key set due for refresh are still returned if
+// the key set was fetched recently, such as when the last refresh failed.
+func (i *jwtIssuer) cachedKey(kid string) (key *jose.JSONWebKey, ok bool, err error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	var k *jose.JSONWebKey
+	if i.keys != nil {
+		k = findKey(i.keys, kid)
+	}
+	if k != nil && time.Since(i.fetchedAt) < jwksRefreshInterval {
+		return k, true, nil
+	}
+	if time.Since(i.attemptedAt) >= jwksMinRefreshInterval {
+		return nil, false, nil
+	}
+	switch {
+	case k != nil:
+		return k, true, nil
+	case i.fetchErr != nil:
+		return nil, true, i.fetchErr
+	default:
+		return nil, true, fmt.Errorf("%w: %q", errUnknownKey, kid)
+	}
+}
+
+func findKey(keys *jose.JSONWebKeySet, kid string) *jose.JSONWebKey {
+	if kid == "" && len(keys.Keys) == 1 {
+		return &keys.Keys[0]
+	}
+	if k := keys.Key(kid); len(k) > 0 {
+		return &k[0]
+	}
+	return nil
+}
+
+func (i *jwtIssuer) fetchKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	jwksURL := i.conf.JWKSURL
+	if jwksURL == "" {
+		var discovery struct {
+			JWKSURI string `json:"jwks_uri"`
+		}
+		if err := fetchJSON(ctx, strings.TrimSuffix(i.conf.Issuer, "/")+"/.well-known/openid-configuration", &discovery); err != nil {
+			return nil, err
+		}
+		jwksURL = discovery.JWKSURI
+	}
+
+	var keys jose.JSONWebKeySet
+	if err := fetchJSON(ctx, jwksURL, &keys); err != nil {
+		return nil, err
+	}
+	return &keys, nil
+}
+
+func fetchJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return fmt.Errorf("server: creating request for %s: %w", url, err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("server: fetching %s: %w", url, err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("server: %w: %s returned status %d", errJWKSFetch, url, res.StatusCode)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("server: decoding %s: %w", url, err)
+	}
+	return nil
+}
+
+// claimStrings returns the strings in a claim that is either an array of strings or
+// a space-separated string, as is common for scopes.
+func claimStrings(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		res := make([]string, 0, len(v))
+		for _, e := range v {
+			if s, ok := e.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
+
+func claimMatches(v any, want string) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case string:
+		return v == want
+	case []any:
+		return slices.ContainsFunc(v, func(e any) bool {
+			return claimMatches(e, want)
+		})
+	default:
+		return fmt.Sprint(v) == want
+	}
+}
+
+// methodAuthPolicy returns the auth policy declared on the method, or nil if none.
+func methodAuthPolicy(method protoreflect.MethodDescriptor) *authv1.Policy {
+	policy, _ := proto.GetExtension(method.Options(), authv1.E_Policy).(*authv1.Policy)
+	return policy
+}
+
+// jwtAuthInterceptor authenticates requests with JWTs from configured issuers and
+// enforces the procedure's auth policy. Procedures without a policy only require a JWT
+// when Firebase auth is not enabled, otherwise a Firebase ID token is also accepted by
+// firebaseAuthInterceptor. Public procedures ignore invalid tokens, as if none were sent.
+type jwtAuthInterceptor struct {
+	s      *Server
+	policy *authv1.Policy
+}
+
+func (i *jwtAuthInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		ctx, err := i.authenticate(ctx, req.Header())
+		if err != nil {
+			return nil, err
+		}
+		return next(ctx, req)
+	}
+}
+
+func (i *jwtAuthInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *jwtAuthInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		ctx, err := i.authenticate(ctx, conn.RequestHeader())
+		if err != nil {
+			return err
+		}
+		return next(ctx, conn)
+	}
+}
+
+func (i *jwtAuthInterceptor) authenticate(ctx context.Context, header http.Header) (context.Context, error) {
+	public := i.policy.GetPublic()
+
+	a := i.s.jwtAuth
+	if a == nil {
+		if i.policy != nil && !public {
+			// Fail closed if a policy is declared without being able to enforce it.
+			return ctx, connect.NewError(connect.CodeUnauthenticated, errJWTAuthNotEnabled)
+		}
+		return ctx, nil
+	}
+
+	t := a.parseRequest(ctx, header)
+	if t == nil {
+		if public || (i.policy == nil && i.s.firebaseAuth != nil) {
+			return ctx, nil
+		}
+		return ctx, connect.NewError(connect.CodeUnauthenticated, errMissingToken)
+	}
+
+	p, err := a.verify(ctx, t)
+	if err != nil {
+		if public {
+			// An invalid token on a public method is treated the same as no token, matching
+			// procedures exempt from Firebase auth.
+			return ctx, nil
+		}
+		return ctx, connect.NewError(connect.CodeUnauthenticated, err)
+	}
+	ctx = context.WithValue(ctx, principalKey{}, p)
+
+	if public {
+		return ctx, nil
+	}
+	if err := checkAuthPolicy(i.policy, p); err != nil {
+		return ctx, connect.NewError(connect.CodePermissionDenied, err)
+	}
+	return ctx, nil
+}
+
+func checkAuthPolicy(policy *authv1.Policy, p *Principal) error {
+	if roles := policy.GetRoles(); len(roles) > 0 && !slices.ContainsFunc(roles, func(r string) bool {
+		return slices.Contains(p.Roles, r)
+	}) {
+		return errMissingRole
+	}
+
+	for name, want := range policy.GetClaims() {
+		if !claimMatches(p.Claims[name], want) {
+			return fmt.Errorf("%w: %s", errMissingClaim, name)
+		}
+	}
+
+	return nil
+}
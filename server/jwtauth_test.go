@@ -0,0 +1,350 @@
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	testpb "google.golang.org/grpc/interop/grpc_testing"
+
+	"github.com/curioswitch/go-curiostack/config"
+	authv1 "github.com/curioswitch/go-curiostack/proto/curiostack/auth/v1"
+	"github.com/curioswitch/go-curiostack/testutil"
+)
+
+type testIssuer struct {
+	url string
+	key *ecdsa.PrivateKey
+
+	// fetches counts requests for the key set, which fail when failing is set.
+	fetches atomic.Int32
+	failing atomic.Bool
+}
+
+// newTestIssuer starts an OIDC issuer serving its configuration and key set.
+func newTestIssuer(t *testing.T) *testIssuer {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	iss := &testIssuer{key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":   iss.url,
+			"jwks_uri": iss.url + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		iss.fetches.Add(1)
+		if iss.failing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+			{Key: &key.PublicKey, KeyID: "test", Algorithm: string(jose.ES256), Use: "sig"},
+		}})
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	iss.url = srv.URL
+
+	return iss
+}
+
+func (i *testIssuer) token(t *testing.T, audience string, extra map[string]any) string {
+	t.Helper()
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.ES256, Key: i.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	require.NoError(t, err)
+
+	tok, err := jwt.Signed(signer).Claims(jwt.Claims{
+		Issuer:   i.url,
+		Subject:  "caller",
+		Audience: jwt.Audience{audience},
+		Expiry:   jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}).Claims(extra).Serialize()
+	require.NoError(t, err)
+	return tok
+}
+
+func TestJWTAuth(t *testing.T) {
+	iss := newTestIssuer(t)
+	otherIss := newTestIssuer(t)
+
+	tests := []struct {
+		name   string
+		policy *authv1.Policy
+		token  string
+		noAuth bool
+
+		code    connect.Code
+		subject string
+	}{
+		{
+			name:  "no policy no token",
+			token: "",
+			code:  connect.CodeUnauthenticated,
+		},
+		{
+			name:    "no policy valid token",
+			token:   iss.token(t, "my-service", nil),
+			subject: "caller",
+		},
+		{
+			name:  "wrong audience",
+			token: iss.token(t, "other-service", nil),
+			code:  connect.CodeUnauthenticated,
+		},
+		{
+			name:  "unknown issuer",
+			token: otherIss.token(t, "my-service", nil),
+			code:  connect.CodeUnauthenticated,
+		},
+		{
+			name:   "public no token",
+			policy: &authv1.Policy{Public: true},
+		},
+		{
+			name:    "public valid token",
+			policy:  &authv1.Policy{Public: true},
+			token:   iss.token(t, "my-service", nil),
+			subject: "caller",
+		},
+		{
+			name:   "public wrong audience",
+			policy: &authv1.Policy{Public: true},
+			token:  iss.token(t, "other-service", nil),
+		},
+		{
+			name:   "public unknown issuer",
+			policy: &authv1.Policy{Public: true},
+			token:  otherIss.token(t, "my-service", nil),
+		},
+		{
+			name:    "has role",
+			policy:  &authv1.Policy{Roles: []string{"admin", "editor"}},
+			token:   iss.token(t, "my-service", map[string]any{"roles": []string{"viewer", "editor"}}),
+			subject: "caller",
+		},
+		{
+			name:   "missing role",
+			policy: &authv1.Policy{Roles: []string{"admin"}},
+			token:  iss.token(t, "my-service", map[string]any{"roles": []string{"viewer"}}),
+			code:   connect.CodePermissionDenied,
+		},
+		{
+			name:    "has claims",
+			policy:  &authv1.Policy{Claims: map[string]string{"email_verified": "true", "groups": "eng"}},
+			token:   iss.token(t, "my-service", map[string]any{"email_verified": true, "groups": []string{"eng"}}),
+			subject: "caller",
+		},
+		{
+			name:   "wrong claim",
+			policy: &authv1.Policy{Claims: map[string]string{"groups": "eng"}},
+			token:  iss.token(t, "my-service", map[string]any{"groups": []string{"sales"}}),
+			code:   connect.CodePermissionDenied,
+		},
+		{
+			name:   "not configured no policy",
+			noAuth: true,
+		},
+		{
+			name:   "not configured with policy",
+			policy: &authv1.Policy{},
+			noAuth: true,
+			code:   connect.CodeUnauthenticated,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			if !tc.noAuth {
+				s.jwtAuth = newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+					{Issuer: iss.url, Audiences: []string{"my-service"}},
+				}})
+			}
+
+			var subject string
+			interceptor := &jwtAuthInterceptor{s: s, policy: tc.policy}
+			call := interceptor.WrapUnary(func(ctx context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+				if p := JWTPrincipal(ctx); p != nil {
+					subject = p.Subject
+				}
+				return connect.NewResponse(&healthpb.HealthCheckResponse{}), nil
+			})
+
+			req := connect.NewRequest(&healthpb.HealthCheckRequest{})
+			if tc.token != "" {
+				req.Header().Set("Authorization", "Bearer "+tc.token)
+			}
+			_, err := call(t.Context(), req)
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.subject, subject)
+		})
+	}
+}
+
+func TestJWTAuthExplicitJWKSURL(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	a := newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+		{Issuer: iss.url, JWKSURL: iss.url + "/jwks", Audiences: []string{"my-service"}, RolesClaim: "scope"},
+	}})
+
+	parsed := a.parse(iss.token(t, "my-service", map[string]any{"scope": "read write"}))
+	require.NotNil(t, parsed)
+	p, err := a.verify(t.Context(), parsed)
+	require.NoError(t, err)
+	require.Equal(t, []string{"read", "write"}, p.Roles)
+}
+
+func TestJWTAuthJWKSUnavailable(t *testing.T) {
+	iss := newTestIssuer(t)
+
+	a := newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+		{Issuer: iss.url, JWKSURL: iss.url + "/jwks", Audiences: []string{"my-service"}},
+	}})
+	verify := func() error {
+		parsed := a.parse(iss.token(t, "my-service", nil))
+		require.NotNil(t, parsed)
+		_, err := a.verify(t.Context(), parsed)
+		return err
+	}
+
+	require.NoError(t, verify())
+	require.Equal(t, int32(1), iss.fetches.Load())
+
+	// Make the cached key set due for refresh while the issuer is failing.
+	iss.failing.Store(true)
+	cached := a.issuers[iss.url]
+	cached.mu.Lock()
+	cached.fetchedAt = cached.fetchedAt.Add(-2 * jwksRefreshInterval)
+	cached.attemptedAt = cached.fetchedAt
+	cached.mu.Unlock()
+
+	// The cached keys are used when the refresh fails, without retrying for every request.
+	for range 3 {
+		require.NoError(t, verify())
+	}
+	require.Equal(t, int32(2), iss.fetches.Load())
+}
+
+func TestJWTAuthJWKSUnavailableWithoutCache(t *testing.T) {
+	iss := newTestIssuer(t)
+	iss.failing.Store(true)
+
+	a := newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+		{Issuer: iss.url, JWKSURL: iss.url + "/jwks", Audiences: []string{"my-service"}},
+	}})
+
+	for range 3 {
+		parsed := a.parse(iss.token(t, "my-service", nil))
+		require.NotNil(t, parsed)
+		_, err := a.verify(t.Context(), parsed)
+		require.ErrorIs(t, err, errJWKSFetch)
+	}
+	require.Equal(t, int32(1), iss.fetches.Load())
+}
+
+func TestJWTAndFirebaseAuth(t *testing.T) {
+	iss := newTestIssuer(t)
+	stub := testutil.NewFirebaseAuthStub(t, "test-project")
+	firebaseToken, err := stub.IDToken("firebase-user", "", nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name  string
+		token string
+
+		code   connect.Code
+		caller string
+	}{
+		{
+			name: "no token",
+			code: connect.CodeUnauthenticated,
+		},
+		{
+			name:   "firebase token",
+			token:  firebaseToken,
+			caller: "firebase:firebase-user",
+		},
+		{
+			name:   "jwt",
+			token:  iss.token(t, "my-service", nil),
+			caller: "jwt:caller",
+		},
+		{
+			name:  "jwt wrong audience",
+			token: iss.token(t, "other-service", nil),
+			code:  connect.CodeUnauthenticated,
+		},
+		{
+			name:  "invalid token",
+			token: "invalid",
+			code:  connect.CodeUnauthenticated,
+		},
+	}
+
+	s := newTestServer(t)
+	s.jwtAuth = newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+		{Issuer: iss.url, Audiences: []string{"my-service"}},
+	}})
+	RequireFirebaseAuth(s, stub)
+	HandleConnectUnary(s,
+		testpb.TestService_UnaryCall_FullMethodName,
+		func(ctx context.Context, _ *testpb.SimpleRequest) (*testpb.SimpleResponse, error) {
+			var caller string
+			if p := JWTPrincipal(ctx); p != nil {
+				caller = "jwt:" + p.Subject
+			}
+			if t := FirebaseToken(ctx); t != nil {
+				caller = "firebase:" + t.UID
+			}
+			return &testpb.SimpleResponse{Username: caller}, nil
+		},
+		nil,
+	)
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	client := connect.NewClient[testpb.SimpleRequest, testpb.SimpleResponse](
+		http.DefaultClient, srv.URL+testpb.TestService_UnaryCall_FullMethodName)
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := connect.NewRequest(&testpb.SimpleRequest{})
+			if tc.token != "" {
+				req.Header().Set("Authorization", "Bearer "+tc.token)
+			}
+			res, err := client.CallUnary(t.Context(), req)
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.caller, res.Msg.GetUsername())
+		})
+	}
+}
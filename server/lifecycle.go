@@ -0,0 +1,76 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+)
+
+var errHookTimeout = errors.New("hook timed out")
+
+type lifecycleHook struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// OnStart registers a hook to be run when the server is started, before it starts
+// listening for requests. Hooks are run in the order they are registered, and if any
+// returns an error, the server will not be started. This can be used to prepare
+// resources such as warming caches or running migrations.
+//
+// Each hook is given up to the configured hook timeout to complete.
+func OnStart(s *Server, name string, hook func(ctx context.Context) error) {
+	s.startHooks = append(s.startHooks, lifecycleHook{name: name, run: hook})
+}
+
+// OnShutdown registers a hook to be run when the server is shutting down, after
+// in-flight requests have been drained. Hooks are run in the reverse order they are
+// registered, so resources should generally register a hook to close themselves right
+// after being created. Errors are logged and do not prevent other hooks from running.
+//
+// Each hook is given up to the configured hook timeout to complete.
+func OnShutdown(s *Server, name string, hook func(ctx context.Context) error) {
+	s.shutdownHooks = append(s.shutdownHooks, lifecycleHook{name: name, run: hook})
+}
+
+func (b *Server) runStartHooks(ctx context.Context) error {
+	for _, h := range b.startHooks {
+		if err := runHook(ctx, h, b.conf.Server.HookTimeout); err != nil {
+			return fmt.Errorf("server: running start hook %s: %w", h.name, err)
+		}
+	}
+	return nil
+}
+
+func (b *Server) runShutdownHooks(ctx context.Context) {
+	// Shutdown hooks should run to completion even if the server is being stopped
+	// by cancellation.
+	ctx = context.WithoutCancel(ctx)
+	for _, h := range slices.Backward(b.shutdownHooks) {
+		if err := runHook(ctx, h, b.conf.Server.HookTimeout); err != nil {
+			slog.ErrorContext(ctx, fmt.Sprintf("Failed to run shutdown hook %s", h.name), "error", err)
+		}
+	}
+}
+
+// runHook runs the hook with the given timeout. If the hook does not respect cancellation
+// of its context, it is abandoned after the timeout.
+func runHook(ctx context.Context, h lifecycleHook, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeoutCause(ctx, timeout, errHookTimeout)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- h.run(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return context.Cause(ctx)
+	}
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+var errHookFailed = errors.New("hook failed")
+
+func TestLifecycleHooks(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+	s.conf.Server.HookTimeout = 50 * time.Millisecond
+
+	var calls []string
+	OnStart(s, "first", func(context.Context) error {
+		calls = append(calls, "start first")
+		return nil
+	})
+	OnStart(s, "second", func(context.Context) error {
+		calls = append(calls, "start second")
+		return nil
+	})
+	OnShutdown(s, "first", func(context.Context) error {
+		calls = append(calls, "shutdown first")
+		return nil
+	})
+	OnShutdown(s, "failing", func(context.Context) error {
+		calls = append(calls, "shutdown failing")
+		return errHookFailed
+	})
+	hangingCause := make(chan error, 1)
+	OnShutdown(s, "hanging", func(ctx context.Context) error {
+		// Blocks until canceled by the hook timeout.
+		<-ctx.Done()
+		hangingCause <- context.Cause(ctx)
+		return ctx.Err()
+	})
+	var lastErr error
+	OnShutdown(s, "last", func(ctx context.Context) error {
+		lastErr = ctx.Err()
+		calls = append(calls, "shutdown last")
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- Start(ctx, s)
+	}()
+	waitForServer(t, "http://"+s.conf.Server.Address+"/internal/health/live")
+	cancel()
+	require.NoError(t, <-startErr)
+	require.NoError(t, lastErr)
+	require.ErrorIs(t, <-hangingCause, errHookTimeout)
+
+	require.Equal(t, []string{
+		"start first",
+		"start second",
+		"shutdown last",
+		"shutdown failing",
+		"shutdown first",
+	}, calls)
+}
+
+func TestLifecycleStartHookFails(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+
+	var calls []string
+	OnStart(s, "failing", func(context.Context) error {
+		calls = append(calls, "start failing")
+		return errHookFailed
+	})
+	OnStart(s, "skipped", func(context.Context) error {
+		calls = append(calls, "start skipped")
+		return nil
+	})
+	OnShutdown(s, "cleanup", func(context.Context) error {
+		calls = append(calls, "shutdown cleanup")
+		return nil
+	})
+
+	err := Start(t.Context(), s)
+	require.ErrorIs(t, err, errHookFailed)
+	require.Equal(t, []string{"start failing", "shutdown cleanup"}, calls)
+}
@@ -0,0 +1,479 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"connectrpc.com/connect"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// openAPIVersion is the version of the OpenAPI specification of generated documents.
+const openAPIVersion = "3.1.0"
+
+// connectErrorSchema is the name of the schema of connect errors in generated documents.
+const connectErrorSchema = "connect.error"
+
+// SetDocsDescriptors registers a serialized FileDescriptorSet of the server's protos,
+// such as descriptors/descriptorset.pb generated by the generate-proto task. Generated
+// Go code does not include comments, so they are read from the descriptors for the docs
+// handler and OpenAPI document when registered.
+func SetDocsDescriptors(s *Server, descriptorSet []byte) {
+	s.docsDescriptors = descriptorSet
+}
+
+type openAPIDocument struct {
+	OpenAPI    string                     `json:"openapi"`
+	Info       openAPIInfo                `json:"info"`
+	Tags       []openAPITag               `json:"tags,omitempty"`
+	Paths      map[string]openAPIPathItem `json:"paths"`
+	Components openAPIComponents          `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title   string `json:"title"`
+	Version string `json:"version"`
+}
+
+type openAPITag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIPathItem struct {
+	Post *openAPIOperation `json:"post"`
+}
+
+type openAPIOperation struct {
+	OperationID string                     `json:"operationId"`
+	Tags        []string                   `json:"tags"`
+	Description string                     `json:"description,omitempty"`
+	Deprecated  bool                       `json:"deprecated,omitempty"`
+	RequestBody openAPIRequestBody         `json:"requestBody"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema   *openAPISchema            `json:"schema"`
+	Examples map[string]openAPIExample `json:"examples,omitempty"`
+}
+
+type openAPIExample struct {
+	Value json.RawMessage `json:"value"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]*openAPISchema `json:"schemas"`
+}
+
+// openAPISchema is a JSON schema of a message, field or enum in its protojson format.
+type openAPISchema struct {
+	Ref                  string            `json:"$ref,omitempty"`
+	Type                 any               `json:"type,omitempty"`
+	Format               string            `json:"format,omitempty"`
+	Pattern              string            `json:"pattern,omitempty"`
+	Description          string            `json:"description,omitempty"`
+	Deprecated           bool              `json:"deprecated,omitempty"`
+	Enum                 []string          `json:"enum,omitempty"`
+	Items                *openAPISchema    `json:"items,omitempty"`
+	Properties           openAPIProperties `json:"properties,omitempty"`
+	AdditionalProperties *openAPISchema    `json:"additionalProperties,omitempty"`
+}
+
+type openAPIProperty struct {
+	name   string
+	schema *openAPISchema
+}
+
+// openAPIProperties are the properties of an object schema, marshaled in the order
+// of the fields in the proto rather than sorted by name.
+type openAPIProperties []openAPIProperty
+
+func (p openAPIProperties) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, prop := range p {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		name, err := json.Marshal(prop.name)
+		if err != nil {
+			return nil, fmt.Errorf("server: marshaling property name: %w", err)
+		}
+		schema, err := json.Marshal(prop.schema)
+		if err != nil {
+			return nil, fmt.Errorf("server: marshaling property %s: %w", prop.name, err)
+		}
+		b.Write(name)
+		b.WriteByte(':')
+		b.Write(schema)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+// openAPIGenerator generates an OpenAPI document describing connect procedures as
+// POST endpoints accepting and returning JSON.
+type openAPIGenerator struct {
+	// descriptors are the descriptors with comments registered with SetDocsDescriptors.
+	descriptors *protoregistry.Files
+
+	schemas map[string]*openAPISchema
+}
+
+// openAPIDocument returns the OpenAPI document for the connect procedures registered
+// on the server.
+func (b *Server) openAPIDocument() ([]byte, error) {
+	g := &openAPIGenerator{schemas: map[string]*openAPISchema{}}
+	if b.docsDescriptors != nil {
+		files, err := parseDescriptors(b.docsDescriptors)
+		if err != nil {
+			return nil, err
+		}
+		g.descriptors = files
+	}
+
+	methods := make([]protoreflect.MethodDescriptor, 0, len(b.procedures))
+	for _, procedure := range b.procedures {
+		name := protoreflect.FullName(strings.ReplaceAll(procedure[1:], "/", "."))
+		d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+		if err != nil {
+			return nil, fmt.Errorf("server: finding method %s: %w", name, err)
+		}
+		if method, ok := d.(protoreflect.MethodDescriptor); ok {
+			methods = append(methods, method)
+		}
+	}
+
+	examples := map[string][]proto.Message{}
+	for _, r := range b.protoDocsRequests {
+		examples[r.procedure] = append(examples[r.procedure], r.reqs...)
+	}
+
+	info := openAPIInfo{
+		Title:   b.conf.Server.OpenAPI.Title,
+		Version: b.conf.Server.OpenAPI.Version,
+	}
+	if info.Title == "" {
+		info.Title = strings.Join(b.services, ", ")
+	}
+	if info.Version == "" {
+		info.Version = "1.0.0"
+	}
+
+	doc, err := g.generate(info, methods, examples)
+	if err != nil {
+		return nil, err
+	}
+	res, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("server: marshaling OpenAPI document: %w", err)
+	}
+	return res, nil
+}
+
+// parseDescriptors parses a serialized FileDescriptorSet. Imports do not need to be
+// included.
+func parseDescriptors(descriptorSet []byte) (*protoregistry.Files, error) {
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(descriptorSet, &set); err != nil {
+		return nil, fmt.Errorf("server: parsing docs descriptors: %w", err)
+	}
+	files, err := protodesc.FileOptions{AllowUnresolvable: true}.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("server: parsing docs descriptors: %w", err)
+	}
+	return files, nil
+}
+
+// generate returns the document describing methods, tagged by their services.
+func (g *openAPIGenerator) generate(
+	info openAPIInfo,
+	methods []protoreflect.MethodDescriptor,
+	examples map[string][]proto.Message,
+) (*openAPIDocument, error) {
+	doc := &openAPIDocument{
+		OpenAPI: openAPIVersion,
+		Info:    info,
+		Paths:   map[string]openAPIPathItem{},
+	}
+
+	g.schemas[connectErrorSchema] = connectErrorSchemaDefinition()
+
+	for _, method := range methods {
+		svc := method.Parent()
+		if !slices.ContainsFunc(doc.Tags, func(t openAPITag) bool { return t.Name == string(svc.FullName()) }) {
+			doc.Tags = append(doc.Tags, openAPITag{
+				Name:        string(svc.FullName()),
+				Description: g.description(svc),
+			})
+		}
+
+		if method.IsStreamingClient() || method.IsStreamingServer() {
+			// Streams use an enveloped format that cannot be described as plain JSON.
+			continue
+		}
+
+		procedure := fmt.Sprintf("/%s/%s", svc.FullName(), method.Name())
+		op, err := g.operation(method, examples[procedure])
+		if err != nil {
+			return nil, err
+		}
+		doc.Paths[procedure] = openAPIPathItem{Post: op}
+	}
+
+	doc.Components.Schemas = g.schemas
+	return doc, nil
+}
+
+func (g *openAPIGenerator) operation(method protoreflect.MethodDescriptor, examples []proto.Message) (*openAPIOperation, error) {
+	req := openAPIMediaType{Schema: g.messageSchema(method.Input())}
+	for i, ex := range examples {
+		value, err := protojson.Marshal(ex)
+		if err != nil {
+			return nil, fmt.Errorf("server: marshaling sample request for %s: %w", method.FullName(), err)
+		}
+		if req.Examples == nil {
+			req.Examples = map[string]openAPIExample{}
+		}
+		req.Examples[fmt.Sprintf("sample%d", i+1)] = openAPIExample{Value: value}
+	}
+
+	deprecated := false
+	if opts, ok := method.Options().(*descriptorpb.MethodOptions); ok {
+		deprecated = opts.GetDeprecated()
+	}
+
+	return &openAPIOperation{
+		OperationID: string(method.FullName()),
+		Tags:        []string{string(method.Parent().FullName())},
+		Description: g.description(method),
+		Deprecated:  deprecated,
+		RequestBody: openAPIRequestBody{
+			Required: true,
+			Content:  map[string]openAPIMediaType{"application/json": req},
+		},
+		Responses: map[string]openAPIResponse{
+			"200": {
+				Description: "Success",
+				Content: map[string]openAPIMediaType{
+					"application/json": {Schema: g.messageSchema(method.Output())},
+				},
+			},
+			"default": {
+				Description: "Error",
+				Content: map[string]openAPIMediaType{
+					"application/json": {Schema: schemaRef(connectErrorSchema)},
+				},
+			},
+		},
+	}, nil
+}
+
+// messageSchema returns the schema for a message, adding it and the types of its
+// fields to the component schemas.
+func (g *openAPIGenerator) messageSchema(md protoreflect.MessageDescriptor) *openAPISchema {
+	if s, ok := wellKnownSchema(md); ok {
+		return s
+	}
+
+	name := string(md.FullName())
+	if _, ok := g.schemas[name]; ok {
+		return schemaRef(name)
+	}
+
+	s := &openAPISchema{
+		Type:        "object",
+		Description: g.description(md),
+		Properties:  openAPIProperties{},
+	}
+	// Registered before fields to handle recursive messages.
+	g.schemas[name] = s
+
+	fields := md.Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		// Field schemas are always newly created so can be annotated.
+		fs := g.fieldSchema(fd)
+		fs.Description = g.description(fd)
+		if opts, ok := fd.Options().(*descriptorpb.FieldOptions); ok && opts.GetDeprecated() {
+			fs.Deprecated = true
+		}
+		s.Properties = append(s.Properties, openAPIProperty{name: fd.JSONName(), schema: fs})
+	}
+
+	return schemaRef(name)
+}
+
+func (g *openAPIGenerator) fieldSchema(fd protoreflect.FieldDescriptor) *openAPISchema {
+	if fd.IsMap() {
+		return &openAPISchema{
+			Type:                 "object",
+			AdditionalProperties: g.singularFieldSchema(fd.MapValue()),
+		}
+	}
+	s := g.singularFieldSchema(fd)
+	if fd.IsList() {
+		return &openAPISchema{Type: "array", Items: s}
+	}
+	return s
+}
+
+func (g *openAPIGenerator) singularFieldSchema(fd protoreflect.FieldDescriptor) *openAPISchema {
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		return g.messageSchema(fd.Message())
+	case protoreflect.EnumKind:
+		return g.enumSchema(fd.Enum())
+	default:
+		return scalarSchema(fd.Kind())
+	}
+}
+
+func (g *openAPIGenerator) enumSchema(ed protoreflect.EnumDescriptor) *openAPISchema {
+	if ed.FullName() == "google.protobuf.NullValue" {
+		return &openAPISchema{Type: "null"}
+	}
+
+	name := string(ed.FullName())
+	if _, ok := g.schemas[name]; ok {
+		return schemaRef(name)
+	}
+
+	values := ed.Values()
+	s := &openAPISchema{
+		Type:        "string",
+		Description: g.description(ed),
+		Enum:        make([]string, values.Len()),
+	}
+	for i := range values.Len() {
+		s.Enum[i] = string(values.Get(i).Name())
+	}
+	g.schemas[name] = s
+
+	return schemaRef(name)
+}
+
+// description returns the comment of the descriptor from its source, or the descriptors
+// registered with SetDocsDescriptors if not present.
+func (g *openAPIGenerator) description(d protoreflect.Descriptor) string {
+	comments := d.ParentFile().SourceLocations().ByDescriptor(d).LeadingComments
+	if comments == "" && g.descriptors != nil {
+		if rd, err := g.descriptors.FindDescriptorByName(d.FullName()); err == nil {
+			comments = rd.ParentFile().SourceLocations().ByDescriptor(rd).LeadingComments
+		}
+	}
+
+	lines := strings.Split(strings.TrimSpace(comments), "\n")
+	for i, l := range lines {
+		lines[i] = strings.TrimPrefix(l, " ")
+	}
+	return strings.Join(lines, "\n")
+}
+
+func schemaRef(name string) *openAPISchema {
+	return &openAPISchema{Ref: "#/components/schemas/" + name}
+}
+
+// scalarSchema returns the schema of a scalar in protojson. 64-bit integers are
+// formatted as strings but integers are also accepted when parsing.
+func scalarSchema(kind protoreflect.Kind) *openAPISchema {
+	switch kind {
+	case protoreflect.BoolKind:
+		return &openAPISchema{Type: "boolean"}
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		return &openAPISchema{Type: "integer", Format: "int32"}
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		return &openAPISchema{Type: "integer", Format: "uint32"}
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		return &openAPISchema{Type: []string{"integer", "string"}, Format: "int64"}
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		return &openAPISchema{Type: []string{"integer", "string"}, Format: "uint64"}
+	case protoreflect.FloatKind:
+		return &openAPISchema{Type: "number", Format: "float"}
+	case protoreflect.DoubleKind:
+		return &openAPISchema{Type: "number", Format: "double"}
+	case protoreflect.BytesKind:
+		return &openAPISchema{Type: "string", Format: "byte"}
+	default:
+		return &openAPISchema{Type: "string"}
+	}
+}
+
+// wellKnownSchema returns the schema of well-known types which have a special
+// representation in protojson.
+func wellKnownSchema(md protoreflect.MessageDescriptor) (*openAPISchema, bool) {
+	if md.ParentFile().Path() == "google/protobuf/wrappers.proto" {
+		return scalarSchema(md.Fields().ByName("value").Kind()), true
+	}
+
+	switch md.FullName() {
+	case "google.protobuf.Timestamp":
+		return &openAPISchema{Type: "string", Format: "date-time"}, true
+	case "google.protobuf.Duration":
+		return &openAPISchema{Type: "string", Pattern: `^-?[0-9]+(\.[0-9]+)?s$`}, true
+	case "google.protobuf.FieldMask":
+		return &openAPISchema{Type: "string"}, true
+	case "google.protobuf.Empty":
+		return &openAPISchema{Type: "object"}, true
+	case "google.protobuf.Struct":
+		return &openAPISchema{Type: "object", AdditionalProperties: &openAPISchema{}}, true
+	case "google.protobuf.ListValue":
+		return &openAPISchema{Type: "array", Items: &openAPISchema{}}, true
+	case "google.protobuf.Value":
+		return &openAPISchema{}, true
+	case "google.protobuf.Any":
+		return &openAPISchema{
+			Type:                 "object",
+			Properties:           openAPIProperties{{name: "@type", schema: &openAPISchema{Type: "string"}}},
+			AdditionalProperties: &openAPISchema{},
+		}, true
+	}
+	return nil, false
+}
+
+// connectErrorSchemaDefinition returns the schema of errors in the connect protocol.
+func connectErrorSchemaDefinition() *openAPISchema {
+	codes := make([]string, 0, connect.CodeUnauthenticated)
+	for c := connect.CodeCanceled; c <= connect.CodeUnauthenticated; c++ {
+		codes = append(codes, c.String())
+	}
+
+	return &openAPISchema{
+		Type:        "object",
+		Description: "An error returned by a connect procedure.",
+		Properties: openAPIProperties{
+			{name: "code", schema: &openAPISchema{Type: "string", Enum: codes}},
+			{name: "message", schema: &openAPISchema{Type: "string"}},
+			{name: "details", schema: &openAPISchema{
+				Type: "array",
+				Items: &openAPISchema{
+					Type: "object",
+					Properties: openAPIProperties{
+						{name: "type", schema: &openAPISchema{Type: "string"}},
+						{name: "value", schema: &openAPISchema{Type: "string", Format: "byte"}},
+						{name: "debug", schema: &openAPISchema{}},
+					},
+				},
+			}},
+		},
+	}
+}
@@ -0,0 +1,222 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func TestOpenAPIEndpoint(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.OpenAPI.Version = "2.0.0"
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		[]*healthpb.HealthCheckRequest{{Service: "books"}},
+	)
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	res := serveTestRequest(s, http.MethodGet, "/internal/openapi.json")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "application/json", res.Header().Get("Content-Type"))
+
+	var doc struct {
+		OpenAPI string                           `json:"openapi"`
+		Info    openAPIInfo                      `json:"info"`
+		Paths   map[string]map[string]any        `json:"paths"`
+		Comps   struct{ Schemas map[string]any } `json:"components"`
+		Tags    []map[string]string              `json:"tags"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &doc))
+
+	require.Equal(t, openAPIVersion, doc.OpenAPI)
+	require.Equal(t, openAPIInfo{Title: "grpc.health.v1.Health", Version: "2.0.0"}, doc.Info)
+	require.Equal(t, []map[string]string{{"name": "grpc.health.v1.Health"}}, doc.Tags)
+
+	require.Contains(t, doc.Paths, healthpb.Health_Check_FullMethodName)
+	// Only registered procedures are served.
+	require.NotContains(t, doc.Paths, healthpb.Health_List_FullMethodName)
+
+	check, err := json.Marshal(doc.Paths[healthpb.Health_Check_FullMethodName]["post"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"operationId": "grpc.health.v1.Health.Check",
+		"tags": ["grpc.health.v1.Health"],
+		"requestBody": {
+			"required": true,
+			"content": {
+				"application/json": {
+					"schema": {"$ref": "#/components/schemas/grpc.health.v1.HealthCheckRequest"},
+					"examples": {"sample1": {"value": {"service": "books"}}}
+				}
+			}
+		},
+		"responses": {
+			"200": {
+				"description": "Success",
+				"content": {
+					"application/json": {
+						"schema": {"$ref": "#/components/schemas/grpc.health.v1.HealthCheckResponse"}
+					}
+				}
+			},
+			"default": {
+				"description": "Error",
+				"content": {
+					"application/json": {
+						"schema": {"$ref": "#/components/schemas/connect.error"}
+					}
+				}
+			}
+		}
+	}`, string(check))
+
+	require.Contains(t, doc.Comps.Schemas, connectErrorSchema)
+	statusEnum, err := json.Marshal(doc.Comps.Schemas["grpc.health.v1.HealthCheckResponse.ServingStatus"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"type": "string",
+		"enum": ["UNKNOWN", "SERVING", "NOT_SERVING", "SERVICE_UNKNOWN"]
+	}`, string(statusEnum))
+}
+
+func TestDocsDescriptors(t *testing.T) {
+	// Generated code does not include comments, which are added to the registered
+	// descriptors as if generated by buf.
+	fdp := protodesc.ToFileDescriptorProto(healthpb.File_grpc_health_v1_health_proto)
+	fdp.SourceCodeInfo = &descriptorpb.SourceCodeInfo{Location: []*descriptorpb.SourceCodeInfo_Location{
+		{Path: []int32{6, 0}, Span: []int32{0, 0, 1}, LeadingComments: proto.String(" Checks health.\n")},
+		{Path: []int32{6, 0, 2, 0}, Span: []int32{1, 0, 1}, LeadingComments: proto.String(" Checks a service.\n")},
+	}}
+	descriptors, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}})
+	require.NoError(t, err)
+
+	s := newTestServer(t)
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			return &healthpb.HealthCheckResponse{}, nil
+		},
+		nil,
+	)
+	SetDocsDescriptors(s, descriptors)
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	res := serveTestRequest(s, http.MethodGet, "/internal/docs/specification.json")
+	require.Equal(t, http.StatusOK, res.Code)
+
+	type descriptionInfo struct {
+		DocString string `json:"docString"`
+	}
+	var spec struct {
+		Services []struct {
+			Name            string          `json:"name"`
+			DescriptionInfo descriptionInfo `json:"descriptionInfo"`
+			Methods         []struct {
+				Name            string          `json:"name"`
+				DescriptionInfo descriptionInfo `json:"descriptionInfo"`
+			} `json:"methods"`
+		} `json:"services"`
+	}
+	require.NoError(t, json.Unmarshal(res.Body.Bytes(), &spec))
+
+	var serviceDoc, methodDoc string
+	for _, svc := range spec.Services {
+		if svc.Name != "grpc.health.v1.Health" {
+			continue
+		}
+		serviceDoc = svc.DescriptionInfo.DocString
+		for _, m := range svc.Methods {
+			if m.Name == "Check" {
+				methodDoc = m.DescriptionInfo.DocString
+			}
+		}
+	}
+	require.Contains(t, serviceDoc, "Checks health.")
+	require.Contains(t, methodDoc, "Checks a service.")
+
+	// Without descriptors, there are no comments.
+	s = newTestServer(t)
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			return &healthpb.HealthCheckResponse{}, nil
+		},
+		nil,
+	)
+	require.NoError(t, s.mountDefaultEndpoints())
+	res = serveTestRequest(s, http.MethodGet, "/internal/docs/specification.json")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.NotContains(t, res.Body.String(), "Checks health.")
+}
+
+func TestOpenAPISchemas(t *testing.T) {
+	fdp := newTestBooksFileProto(t)
+
+	// Descriptors from generated code do not have comments, which are read from the
+	// registered descriptors instead.
+	withComments, err := proto.Marshal(&descriptorpb.FileDescriptorSet{File: []*descriptorpb.FileDescriptorProto{fdp}})
+	require.NoError(t, err)
+	fdp = proto.CloneOf(fdp)
+	fdp.SourceCodeInfo = nil
+	fd, err := protodesc.NewFile(fdp, protoregistry.GlobalFiles)
+	require.NoError(t, err)
+
+	descriptors, err := parseDescriptors(withComments)
+	require.NoError(t, err)
+	g := &openAPIGenerator{descriptors: descriptors, schemas: map[string]*openAPISchema{}}
+
+	methods := fd.Services().Get(0).Methods()
+	doc, err := g.generate(openAPIInfo{Title: "Books", Version: "1.0.0"},
+		[]protoreflect.MethodDescriptor{methods.ByName("GetBook"), methods.ByName("WatchBooks")}, nil)
+	require.NoError(t, err)
+
+	require.Equal(t, []openAPITag{{Name: "test.books.BookService", Description: "Manages books."}}, doc.Tags)
+	// Streaming procedures cannot be described as JSON endpoints.
+	require.Len(t, doc.Paths, 1)
+	op := doc.Paths["/test.books.BookService/GetBook"].Post
+	require.Equal(t, "Gets a book.\nReturns not found if missing.", op.Description)
+	require.True(t, op.Deprecated)
+
+	book, err := json.Marshal(doc.Components.Schemas["test.books.Book"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"type": "object",
+		"description": "A book.",
+		"properties": {
+			"name": {"type": "string", "description": "The name of the book."},
+			"title": {"type": "string"},
+			"pageCount": {"type": ["integer", "string"], "format": "int64"},
+			"tags": {"type": "array", "items": {"type": "string"}},
+			"counts": {"type": "object", "additionalProperties": {"type": "integer", "format": "int32"}},
+			"published": {"type": "string", "format": "date-time"},
+			"genre": {"$ref": "#/components/schemas/test.books.Genre"},
+			"sequel": {"$ref": "#/components/schemas/test.books.Book", "deprecated": true}
+		}
+	}`, string(book))
+
+	// Properties keep the order of fields in the proto.
+	var names []string
+	for _, p := range doc.Components.Schemas["test.books.Book"].Properties {
+		names = append(names, p.name)
+	}
+	require.Equal(t, []string{"name", "title", "pageCount", "tags", "counts", "published", "genre", "sequel"}, names)
+
+	genre, err := json.Marshal(doc.Components.Schemas["test.books.Genre"])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"type": "string",
+		"enum": ["GENRE_UNSPECIFIED", "GENRE_FICTION"]
+	}`, string(genre))
+}
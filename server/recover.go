@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/curioswitch/go-curiostack/otel"
+)
+
+var errPanic = errors.New("panic")
+
+// panicCounter counts panics recovered from connect handlers.
+var panicCounter = sync.OnceValue(func() metric.Int64Counter {
+	// Creating an instrument only fails for an invalid name, which is constant here.
+	c, _ := otel.Meter(instrumentationName).Int64Counter(
+		"rpc.server.panics",
+		metric.WithDescription("Number of panics recovered from connect handlers."),
+		metric.WithUnit("{panic}"),
+	)
+	return c
+})
+
+// recoverInterceptor recovers panics in connect handlers, returning an internal error
+// so it is written in the protocol of the request instead of as a plain HTTP error.
+type recoverInterceptor struct{}
+
+func (i *recoverInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (_ connect.AnyResponse, err error) {
+		defer recoverPanic(ctx, req.Spec(), &err)
+		return next(ctx, req)
+	}
+}
+
+func (i *recoverInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *recoverInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) (err error) {
+		defer recoverPanic(ctx, conn.Spec(), &err)
+		return next(ctx, conn)
+	}
+}
+
+// recoverPanic converts a panic into an internal error, logging it and recording it
+// on the active span. It must be deferred.
+func recoverPanic(ctx context.Context, spec connect.Spec, err *error) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler { //nolint:errorlint,err113 // net/http compares with ==
+		// Intentionally aborting the response, let net/http handle it.
+		panic(p)
+	}
+
+	stack := string(debug.Stack())
+	perr := fmt.Errorf("%w: %v", errPanic, p)
+
+	slog.ErrorContext(ctx, fmt.Sprintf("Recovered panic in %s", spec.Procedure), "error", perr, "stack", stack)
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(perr, trace.WithAttributes(attribute.String("exception.stacktrace", stack)))
+	span.SetStatus(codes.Error, perr.Error())
+
+	panicCounter().Add(ctx, 1, metric.WithAttributes(attribute.String("rpc.method", spec.Procedure)))
+
+	*err = connect.NewError(connect.CodeInternal, errPanic)
+}
@@ -0,0 +1,87 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestRecoverPanic(t *testing.T) {
+	s := newTestServer(t)
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(_ context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			panic("boom")
+		},
+		nil,
+	)
+
+	srv := httptest.NewUnstartedServer(s.mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		opts []connect.ClientOption
+	}{
+		{
+			name: "connect",
+		},
+		{
+			name: "grpc",
+			opts: []connect.ClientOption{connect.WithGRPC()},
+		},
+		{
+			name: "grpc-web",
+			opts: []connect.ClientOption{connect.WithGRPCWeb()},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+				srv.Client(),
+				srv.URL+healthpb.Health_Check_FullMethodName,
+				tc.opts...,
+			)
+			_, err := client.CallUnary(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+			require.Equal(t, connect.CodeInternal, connect.CodeOf(err))
+			require.NotContains(t, err.Error(), "boom")
+		})
+	}
+}
+
+func TestRecoverPanicSpan(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	ctx, span := tp.Tracer("test").Start(t.Context(), "test")
+
+	call := (&recoverInterceptor{}).WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+		panic("boom")
+	})
+	_, err := call(ctx, connect.NewRequest(&healthpb.HealthCheckRequest{}))
+	span.End()
+	require.Equal(t, connect.CodeInternal, connect.CodeOf(err))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 1)
+	require.Len(t, spans[0].Events(), 1)
+	require.Equal(t, "exception", spans[0].Events()[0].Name)
+
+	t.Run("abort handler", func(t *testing.T) {
+		call := (&recoverInterceptor{}).WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+			panic(http.ErrAbortHandler)
+		})
+		require.PanicsWithValue(t, http.ErrAbortHandler, func() {
+			_, _ = call(t.Context(), connect.NewRequest(&healthpb.HealthCheckRequest{}))
+		})
+	})
+}
@@ -0,0 +1,61 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+
+	"connectrpc.com/connect"
+	"connectrpc.com/grpcreflect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+func TestReflection(t *testing.T) {
+	tests := []struct {
+		name    string
+		enabled bool
+	}{
+		{
+			name:    "enabled",
+			enabled: true,
+		},
+		{
+			name:    "disabled",
+			enabled: false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.EnableReflection = tc.enabled
+			s.services = append(s.services, "grpc.health.v1.Health")
+			require.NoError(t, s.mountDefaultEndpoints())
+
+			srv := newTestHTTP2Server(t, s)
+
+			client := grpcreflect.NewClient(srv.Client(), srv.URL, connect.WithGRPC())
+			stream := client.NewStream(t.Context())
+			defer func() {
+				_, _ = stream.Close()
+			}()
+
+			services, err := stream.ListServices()
+			if !tc.enabled {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, []protoreflect.FullName{"grpc.health.v1.Health"}, services)
+		})
+	}
+}
+
+func TestReflectionNotFound(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.EnableReflection = true
+	require.NoError(t, s.mountDefaultEndpoints())
+
+	res := serveTestRequest(s, http.MethodPost, "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo")
+	require.Equal(t, http.StatusNotFound, res.Code)
+}
@@ -7,12 +7,19 @@ import (
 	"io/fs"
 	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
 	"slices"
 	"strings"
+	"sync"
+	"syscall"
+	"time"
 
+	"connectrpc.com/grpcreflect"
 	docshandler "github.com/curioswitch/go-docs-handler"
 	protodocs "github.com/curioswitch/go-docs-handler/plugins/proto"
 	"github.com/go-chi/chi/v5"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/protobuf/proto"
 
 	"github.com/curioswitch/go-curiostack/config"
@@ -34,10 +41,55 @@ type Server struct {
 
 	conf *config.Common
 
-	protoDocsRequests  []protoDocsRequests
-	docsFirebaseDomain string
+	// services are the names of all services with a procedure registered on the server.
+	services []string
+	// procedures are the names of all procedures registered on the server, such as
+	// "/grpc.health.v1.Health/Check".
+	procedures []string
+
+	protoDocsRequests []protoDocsRequests
+	docsAuth          DocsAuth
+	docsDescriptors   []byte
+	docsSamples       fs.FS
+
+	// restRoutes are REST routes transcoded from google.api.http annotations.
+	restRoutes []*restRoute
+
+	// httpRoutes are routes registered on the mux documented with DocumentHTTPRoute.
+	httpRoutes []*httpRouteDocs
+
+	health *healthChecker
+
+	firebaseAuth *firebaseAuth
+	jwtAuth      *jwtAuth
+
+	internalGuard *internalGuard
+
+	startHooks    []lifecycleHook
+	shutdownHooks []lifecycleHook
+
+	workers []*backgroundWorker
 
 	startCalled bool
+	// serving is set once Start has started running workers and serving requests, to
+	// distinguish failures while running the server from failures setting it up.
+	serving bool
+}
+
+func newServer(conf *config.Common) *Server {
+	s := &Server{
+		mux: NewMuxFromConfig(conf),
+
+		conf: conf,
+
+		health: newHealthChecker(&conf.Server.Health),
+
+		jwtAuth: newJWTAuth(&conf.Server.Auth),
+	}
+	// Auth may be enabled after routes are registered, so the middleware is always
+	// installed and checks the server's configuration when serving.
+	s.mux.Use(s.protectInternal, s.verifyFirebaseToken)
+	return s
 }
 
 // Mux returns the [chi.Mux] that will be served and can be used to add
@@ -49,18 +101,28 @@ func Mux(s *Server) *chi.Mux {
 	return s.mux
 }
 
-// EnableDocsFirebaseAuth enables Firebase auth for the docs handler. The domain
-// must be the auth domain of the Firebase project.
-//
-// Firebase credentials of the browser, generally set by running the actual web app
-// locally, will be read and added as authorization headers in requests to the
-// server.
-func EnableDocsFirebaseAuth(s *Server, domain string) {
-	s.docsFirebaseDomain = domain
-}
-
 // Start starts the server, listening on the configured server address for requests
-// based on its configuration. This method will block until program exit.
+// based on its configuration. This method will block until ctx is done, generally
+// when the process receives a termination signal. At that point, health checks will
+// start failing and, after the configured shutdown delay to allow load balancers to
+// observe them, in-flight requests will be given up to the configured drain timeout to
+// complete before returning. If the server fails, such as when the address is already
+// in use, it is shut down without waiting for the shutdown delay.
+//
+// Hooks registered with OnStart are run before listening for requests, and hooks
+// registered with OnShutdown are run after requests have been drained. Workers
+// registered with RunBackground are run alongside the server and cancelled after
+// requests have been drained. If a critical worker fails, the server is shut down
+// and the error is returned.
+//
+// If an admin address is configured, /internal/ endpoints, gRPC health checks and
+// reflection are served on it instead of the main address. /internal/ endpoints other
+// than health checks are protected as configured in config.Internal.
+//
+// If config.OpenAPI.OutputFile is set, the OpenAPI document for the server is written to
+// it and Start returns without serving or running OnStart hooks. The setup before Start,
+// such as connecting to databases, is still run, so it must succeed without them to use
+// the openapi task.
 func Start(ctx context.Context, s *Server) error {
 	s.startCalled = true
 
@@ -68,20 +130,158 @@ func Start(ctx context.Context, s *Server) error {
 		return err
 	}
 
+	if out := s.conf.Server.OpenAPI.OutputFile; out != "" {
+		return writeOpenAPIDocument(ctx, s, out)
+	}
+
 	srv := NewServer(s.mux, s.conf)
-	defer func() {
-		if err := srv.Close(); err != nil {
-			slog.WarnContext(ctx, "Failed to close server", "error", err)
+	if srv.TLSConfig != nil {
+		// Load certificates eagerly to fail fast on misconfiguration.
+		if _, err := srv.TLSConfig.GetConfigForClient(nil); err != nil {
+			return err
 		}
-	}()
+	}
 
-	slog.InfoContext(ctx, fmt.Sprintf("Starting server on address %v", srv.Addr))
-	if err := srv.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
-		return fmt.Errorf("server: failed to start server: %w", err)
+	if err := s.runStartHooks(ctx); err != nil {
+		s.runShutdownHooks(ctx)
+		return err
 	}
+	defer s.runShutdownHooks(ctx)
+
+	s.serving = true
+	workers := s.startWorkers(ctx)
+
+	// Servers are shutdown in order, so the admin server is last to allow
+	// health checks to observe draining.
+	servers := []*http.Server{srv}
+	if addr := s.conf.Server.AdminAddress; addr != "" {
+		srv.Handler = filterInternalRoutes(s.mux, false)
+		adminSrv := NewServer(filterInternalRoutes(s.mux, true), s.conf)
+		adminSrv.Addr = addr
+		servers = append(servers, adminSrv)
+	}
+
+	serveErr := make(chan error, len(servers))
+	for _, srv := range servers {
+		slog.InfoContext(ctx, fmt.Sprintf("Starting server on address %v", srv.Addr))
+		go func() {
+			serveErr <- serve(srv)
+		}()
+	}
+	running := len(servers)
+
+	var err error
+	graceful := false
+	select {
+	case err = <-serveErr:
+		// Servers only return without error after shutdown, so this is always an error.
+		running--
+		err = fmt.Errorf("server: failed to serve: %w", err)
+	case err = <-workers.failed:
+	case <-ctx.Done():
+		graceful = true
+	}
+
+	s.health.startDraining()
+	if delay := s.conf.Server.ShutdownDelay; graceful && delay > 0 {
+		// Keep serving while load balancers observe the failing health checks.
+		slog.InfoContext(ctx, fmt.Sprintf("Waiting %v before shutting down server", delay))
+		time.Sleep(delay)
+	}
+	slog.InfoContext(ctx, fmt.Sprintf("Shutting down server, draining requests for up to %v", s.conf.Server.DrainTimeout))
+	shutdownServers(ctx, servers, s.conf.Server.DrainTimeout)
+	workers.stop(ctx, s.conf.Server.DrainTimeout)
+
+	for range running {
+		if serr := <-serveErr; serr != nil && err == nil {
+			err = fmt.Errorf("server: failed to serve: %w", serr)
+		}
+	}
+	return err
+}
+
+// writeOpenAPIDocument writes the OpenAPI document for the server to path.
+func writeOpenAPIDocument(ctx context.Context, s *Server, path string) error {
+	doc, err := s.openAPIDocument()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, doc, 0o644); err != nil { //nolint:gosec // document is not secret
+		return fmt.Errorf("server: writing OpenAPI document: %w", err)
+	}
+	slog.InfoContext(ctx, "Wrote OpenAPI document to "+path)
 	return nil
 }
 
+// serve serves requests on srv until it is shutdown.
+func serve(srv *http.Server) error {
+	var err error
+	if srv.TLSConfig != nil {
+		err = srv.ListenAndServeTLS("", "")
+	} else {
+		err = srv.ListenAndServe()
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+// shutdownServers gracefully shuts down servers concurrently, waiting up to timeout in
+// total for in-flight requests to complete before forcibly closing connections.
+func shutdownServers(ctx context.Context, servers []*http.Server, timeout time.Duration) {
+	shutdownCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), timeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Go(func() {
+			shutdownServer(ctx, shutdownCtx, srv)
+		})
+	}
+	wg.Wait()
+}
+
+// shutdownServer gracefully shuts down srv, waiting until shutdownCtx is done for
+// in-flight requests to complete before forcibly closing connections.
+func shutdownServer(ctx context.Context, shutdownCtx context.Context, srv *http.Server) {
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.WarnContext(ctx, fmt.Sprintf("Failed to drain server on address %v, closing remaining connections", srv.Addr), "error", err)
+		if err := srv.Close(); err != nil {
+			slog.WarnContext(ctx, "Failed to close server", "error", err)
+		}
+	}
+}
+
+// adminRoutePrefixes are the prefixes of routes served on the admin address when
+// configured, which are not exposed to clients.
+var adminRoutePrefixes = []string{
+	"/internal/",
+	"/" + healthpb.Health_ServiceDesc.ServiceName + "/",
+	"/" + grpcreflect.ReflectV1ServiceName + "/",
+	"/" + grpcreflect.ReflectV1AlphaServiceName + "/",
+}
+
+// isAdminRoute returns whether p is the path of a route served on the admin address.
+func isAdminRoute(p string) bool {
+	return slices.ContainsFunc(adminRoutePrefixes, func(prefix string) bool {
+		return strings.HasPrefix(p, prefix)
+	})
+}
+
+// filterInternalRoutes serves only admin routes of h, such as /internal/ routes and
+// health checks, if internal is true, or only other routes if false, returning 404 for
+// the rest.
+func filterInternalRoutes(h http.Handler, internal bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if isAdminRoute(r.URL.Path) != internal {
+			http.NotFound(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
 // Main is the entrypoint for starting a server using CurioStack.
 // It should be called from your main function and passed a pointer to your
 // configuration object which embeds [config.Common]. The setup callback
@@ -94,10 +294,14 @@ func Start(ctx context.Context, s *Server) error {
 // pointer to an empty struct. confFiles is a [fs.FS] to resolve config files as
 // used by [config.Load].
 //
+// The context passed to the setup callback is cancelled when the process receives
+// SIGINT or SIGTERM, which will cause Start to gracefully shut down the server.
+//
 // An exit code is returned, so the general pattern for this function will
 // be to call [os.Exit] with the result of this function.
 func Main[T config.CurioStack](conf T, confFiles fs.FS, run func(ctx context.Context, conf T, b *Server) error) int {
-	ctx := context.Background()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
 	otel.Initialize() // initialize as early as possible to instrument globals
 
@@ -108,14 +312,17 @@ func Main[T config.CurioStack](conf T, confFiles fs.FS, run func(ctx context.Con
 
 	logging.Initialize(&conf.GetCommon().Logging)
 
-	b := &Server{
-		mux: NewMux(),
-
-		conf: conf.GetCommon(),
-	}
+	b := newServer(conf.GetCommon())
 
 	if err := run(ctx, conf, b); err != nil {
-		slog.Error(fmt.Sprintf("Failed to configure server: %v", err))
+		switch {
+		case b.serving:
+			slog.Error(fmt.Sprintf("Server failed: %v", err))
+		case b.startCalled:
+			slog.Error(fmt.Sprintf("Failed to start server: %v", err))
+		default:
+			slog.Error(fmt.Sprintf("Failed to configure server: %v", err))
+		}
 		return 1
 	}
 
@@ -128,47 +335,74 @@ func Main[T config.CurioStack](conf T, confFiles fs.FS, run func(ctx context.Con
 }
 
 func (b *Server) mountDefaultEndpoints() error {
-	docsDefined := false
-	healthDefined := false
-	// Define /internal/health if not already defined.
+	// Define default endpoints if not already defined.
+	defined := map[string]bool{}
 	_ = chi.Walk(b.mux, func(_, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
-		switch route {
-		case "/internal/docs/*":
-			docsDefined = true
-		case "/internal/health":
-			healthDefined = true
-		}
+		defined[route] = true
 		return nil
 	})
 
-	if !docsDefined {
-		var services []string
-		for _, r := range b.protoDocsRequests {
-			svc, _, _ := strings.Cut(r.procedure[1:], "/")
-			if !slices.Contains(services, svc) {
-				services = append(services, svc)
+	guard, err := newInternalGuard(b, &b.conf.Server.Internal)
+	if err != nil {
+		return err
+	}
+	b.internalGuard = guard
+
+	if err := b.loadDocsSamples(); err != nil {
+		return err
+	}
+
+	docsEnabled := !b.conf.Server.Internal.DisableDocs
+
+	if docsEnabled && !defined["/internal/docs/*"] {
+		if len(b.services) > 0 || len(b.httpRoutes) > 0 {
+			var plugins []docshandler.Plugin
+			if len(b.services) > 0 {
+				protodocopts := make([]protodocs.Option, 0, len(b.protoDocsRequests)+len(b.services)-1)
+
+				for _, r := range b.protoDocsRequests {
+					protodocopts = append(protodocopts, protodocs.WithExampleRequests(r.procedure, r.reqs[0], r.reqs[1:]...))
+				}
+
+				for _, svc := range b.services[1:] {
+					protodocopts = append(protodocopts, protodocs.WithAdditionalService(svc))
+				}
+
+				if b.docsDescriptors != nil {
+					protodocopts = append(protodocopts, protodocs.WithSerializedDescriptors(b.docsDescriptors))
+				}
+
+				plugins = append(plugins, protodocs.NewPlugin(b.services[0], protodocopts...))
 			}
-		}
-		if len(services) > 0 {
-			var docopts []docshandler.Option
-			protodocopts := make([]protodocs.Option, 0, len(b.protoDocsRequests)+len(services)-1)
 
-			for _, r := range b.protoDocsRequests {
-				protodocopts = append(protodocopts, protodocs.WithExampleRequests(r.procedure, r.reqs[0], r.reqs[1:]...))
+			if len(b.restRoutes) > 0 {
+				plugins = append(plugins, &restDocsPlugin{routes: b.restRoutes})
 			}
 
-			for _, svc := range services[1:] {
-				protodocopts = append(protodocopts, protodocs.WithAdditionalService(svc))
+			if len(b.httpRoutes) > 0 {
+				plugins = append(plugins, &httpDocsPlugin{routes: b.httpRoutes})
 			}
 
-			if b.docsFirebaseDomain != "" {
-				script := docsFirebaseAuthScript(b.docsFirebaseDomain)
+			var docopts []docshandler.Option
+			for _, p := range plugins[1:] {
+				docopts = append(docopts, docshandler.WithAdditionalPlugin(p))
+			}
+
+			docsAuth := b.docsAuth
+			if docsAuth == nil && b.conf.Server.DocsAuth.Provider != "" {
+				var err error
+				if docsAuth, err = docsAuthFromConfig(&b.conf.Server.DocsAuth); err != nil {
+					return err
+				}
+			}
+			if docsAuth != nil {
+				script := docsAuth.script()
 				docopts = append(docopts, docshandler.WithInjectedScriptSupplier(func() string {
 					return script
 				}))
 			}
 
-			docs, err := docshandler.New(protodocs.NewPlugin(services[0], protodocopts...), docopts...)
+			docs, err := docshandler.New(plugins[0], docopts...)
 			if err != nil {
 				return fmt.Errorf("server: create docs handler: %w", err)
 			}
@@ -176,43 +410,39 @@ func (b *Server) mountDefaultEndpoints() error {
 		}
 	}
 
-	if !healthDefined {
-		b.mux.Get("/internal/health", func(w http.ResponseWriter, _ *http.Request) {
-			w.WriteHeader(http.StatusOK)
+	if docsEnabled && !defined["/internal/openapi.json"] && len(b.services) > 0 {
+		doc, err := b.openAPIDocument()
+		if err != nil {
+			return err
+		}
+		b.mux.Get("/internal/openapi.json", func(w http.ResponseWriter, _ *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write(doc)
 		})
 	}
 
-	return nil
-}
-
-func docsFirebaseAuthScript(domain string) string {
-	return fmt.Sprintf(`
-		function include(url) {
-			return new Promise((resolve, reject) => {
-				var script = document.createElement('script');
-				script.type = 'text/javascript';
-				script.src = url;
-
-				script.onload = function() {
-					resolve({ script });
-				};
-
-				document.getElementsByTagName('head')[0].appendChild(script);
-			});
-		}
+	if !defined["/internal/health"] {
+		// Kept for compatibility with deployments that predate separate liveness and
+		// readiness endpoints.
+		b.mux.Get("/internal/health", b.health.handleReady)
+	}
+	if !defined["/internal/health/live"] {
+		b.mux.Get("/internal/health/live", b.health.handleLive)
+	}
+	if !defined["/internal/health/ready"] {
+		b.mux.Get("/internal/health/ready", b.health.handleReady)
+	}
+	if b.conf.Server.EnableReflection && len(b.services) > 0 {
+		reflector := grpcreflect.NewStaticReflector(b.services...)
+		path, h := grpcreflect.NewHandlerV1(reflector)
+		b.mux.Handle(path+"*", h)
+		path, h = grpcreflect.NewHandlerV1Alpha(reflector)
+		b.mux.Handle(path+"*", h)
+	}
 
-		async function loadScripts() {
-			await include("https://%s/__/firebase/8.10.1/firebase-app.js");
-			await include("https://%s/__/firebase/8.10.1/firebase-auth.js");
-			await include("https://%s/__/firebase/init.js");
-			firebase.auth();
-		}
-		loadScripts();
+	if !defined[healthpb.Health_Check_FullMethodName] {
+		(&grpcHealthService{s: b}).mount(b.mux)
+	}
 
-		async function getAuthorization() {
-			const token = await firebase.auth().currentUser.getIdToken();
-			return {"Authorization": "Bearer " + token};
-		}
-		window.armeria.registerHeaderProvider(getAuthorization);
-	`, domain, domain, domain)
+	return nil
 }
@@ -0,0 +1,209 @@
+package server
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+func TestStartAdminAddress(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+	s.conf.Server.AdminAddress = freeAddress(t)
+	Mux(s).Get("/hello", func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	ctx, cancel := context.WithCancel(t.Context())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- Start(ctx, s)
+	}()
+
+	publicURL := "http://" + s.conf.Server.Address
+	adminURL := "http://" + s.conf.Server.AdminAddress
+	waitForServer(t, adminURL+"/internal/health/live")
+
+	require.Equal(t, http.StatusOK, getStatus(t, publicURL+"/hello"))
+	require.Equal(t, http.StatusNotFound, getStatus(t, publicURL+"/internal/health/live"))
+	require.Equal(t, http.StatusOK, getStatus(t, adminURL+"/internal/health/live"))
+	require.Equal(t, http.StatusNotFound, getStatus(t, adminURL+"/hello"))
+
+	healthReq := connect.NewRequest(&healthpb.HealthCheckRequest{})
+	_, err := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		http.DefaultClient, adminURL+healthpb.Health_Check_FullMethodName,
+	).CallUnary(t.Context(), healthReq)
+	require.NoError(t, err)
+	_, err = connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		http.DefaultClient, publicURL+healthpb.Health_Check_FullMethodName,
+	).CallUnary(t.Context(), healthReq)
+	require.Equal(t, connect.CodeUnimplemented, connect.CodeOf(err))
+
+	cancel()
+	select {
+	case err := <-startErr:
+		require.NoError(t, err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+}
+
+func TestStartShutdownDelay(t *testing.T) {
+	s := newTestServer(t)
+	s.conf.Server.Address = freeAddress(t)
+	s.conf.Server.ShutdownDelay = 500 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(t.Context())
+	startErr := make(chan error, 1)
+	go func() {
+		startErr <- Start(ctx, s)
+	}()
+
+	readyURL := "http://" + s.conf.Server.Address + "/internal/health/ready"
+	waitForServer(t, readyURL)
+	require.Equal(t, http.StatusOK, getStatus(t, readyURL))
+
+	cancel()
+	cancelled := time.Now()
+
+	// The server keeps serving failing health checks during the delay.
+	require.Eventually(t, func() bool {
+		res, err := http.Get(readyURL)
+		if err != nil {
+			return false
+		}
+		_ = res.Body.Close()
+		return res.StatusCode == http.StatusServiceUnavailable
+	}, time.Second, 10*time.Millisecond)
+
+	select {
+	case err := <-startErr:
+		require.NoError(t, err)
+		require.GreaterOrEqual(t, time.Since(cancelled), s.conf.Server.ShutdownDelay)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+
+	_, err := http.Get(readyURL) //nolint:bodyclose // fails to connect
+	require.Error(t, err)
+}
+
+func TestMainSignal(t *testing.T) {
+	addr := freeAddress(t)
+
+	exitCode := make(chan int, 1)
+	go func() {
+		exitCode <- Main(&config.Common{}, nil, func(ctx context.Context, conf *config.Common, s *Server) error {
+			conf.Server.Address = addr
+			return Start(ctx, s)
+		})
+	}()
+
+	waitForServer(t, "http://"+addr+"/internal/health/live")
+
+	p, err := os.FindProcess(os.Getpid())
+	require.NoError(t, err)
+	require.NoError(t, p.Signal(syscall.SIGTERM))
+
+	select {
+	case code := <-exitCode:
+		require.Equal(t, 0, code)
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down on SIGTERM")
+	}
+}
+
+func TestShutdownServersConcurrently(t *testing.T) {
+	started := make(chan struct{}, 2)
+	release := make(chan struct{})
+	defer close(release)
+
+	var servers []*http.Server
+	for range 2 {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		srv := &http.Server{
+			Handler: http.HandlerFunc(func(http.ResponseWriter, *http.Request) {
+				started <- struct{}{}
+				<-release
+			}),
+			ReadHeaderTimeout: time.Second,
+		}
+		go func() {
+			_ = srv.Serve(l)
+		}()
+		go func() {
+			res, err := http.Get("http://" + l.Addr().String())
+			if err == nil {
+				_ = res.Body.Close()
+			}
+		}()
+		servers = append(servers, srv)
+	}
+	<-started
+	<-started
+
+	timeout := 300 * time.Millisecond
+	start := time.Now()
+	shutdownServers(t.Context(), servers, timeout)
+	elapsed := time.Since(start)
+
+	// Both servers wait for the hanging requests under a single deadline.
+	require.GreaterOrEqual(t, elapsed, timeout)
+	require.Less(t, elapsed, 2*timeout)
+}
+
+func TestStartAddressInUse(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer l.Close()
+
+	s := newTestServer(t)
+	s.conf.Server.Address = l.Addr().String()
+	s.conf.Server.ShutdownDelay = time.Minute
+
+	// Fails without waiting for the shutdown delay.
+	require.Error(t, Start(t.Context(), s))
+}
+
+func freeAddress(t *testing.T) string {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	return addr
+}
+
+func waitForServer(t *testing.T, url string) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		res, err := http.Get(url)
+		if err != nil {
+			return false
+		}
+		_ = res.Body.Close()
+		return true
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func getStatus(t *testing.T, url string) int {
+	t.Helper()
+
+	res, err := http.Get(url)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	return res.StatusCode
+}
@@ -1,9 +1,10 @@
 package server
 
 import (
+	"context"
+	"io"
 	"net/http"
 	"strings"
-	"time"
 
 	"github.com/curioswitch/go-usegcp/middleware/requestlog"
 	"github.com/go-chi/chi/v5"
@@ -13,29 +14,102 @@ import (
 	"github.com/curioswitch/go-curiostack/otel"
 )
 
-// NewMux returns a new chi.Mux with standard middleware.
+// instrumentationName is the name of the OpenTelemetry instrumentation scope for
+// metrics recorded by the server.
+const instrumentationName = "github.com/curioswitch/go-curiostack/server"
+
+// NewMux returns a new chi.Mux with standard middleware. Use NewMuxFromConfig to also
+// apply the middleware configured in config.Server.
 func NewMux() *chi.Mux {
+	return newMux(nil)
+}
+
+// NewMuxFromConfig returns a new chi.Mux with standard middleware and the middleware
+// configured in config.Server. If config.CORS allows any origins, cross-origin requests
+// are handled with the headers for the connect and gRPC-web protocols allowed. Request
+// bodies are limited to config.MaxRequestBytes, except for connect procedures registered
+// on a Server, which limit the size of each message instead.
+func NewMuxFromConfig(conf *config.Common) *chi.Mux {
+	return newMux(&conf.Server)
+}
+
+func newMux(conf *config.Server) *chi.Mux {
 	r := chi.NewRouter()
 
 	r.Use(middleware.Recoverer)
+	if conf != nil {
+		if cors := corsMiddleware(&conf.CORS); cors != nil {
+			// Before observability middleware so preflight requests are not logged or traced.
+			r.Use(cors)
+		}
+	}
 	r.Use(otel.HTTPMiddleware())
 	r.Use(middleware.Maybe(requestlog.NewMiddleware(), func(r *http.Request) bool {
-		return !strings.HasPrefix(r.URL.Path, "/internal/")
+		return !strings.HasPrefix(r.URL.Path, "/internal/") && !strings.HasPrefix(r.URL.Path, "/grpc.health.v1.Health/")
 	}))
+	if conf != nil {
+		r.Use(limitRequestBody(int64(conf.MaxRequestBytes)))
+	}
 
 	return r
 }
 
 // NewServer returns a new http.Server with standard settings to serve the given router.
+// If TLS is configured, the returned server's TLSConfig will serve the configured certificates,
+// reloading them when they change, and the server should be started with ListenAndServeTLS
+// with empty file names.
 func NewServer(router http.Handler, conf *config.Common) *http.Server {
 	protocols := &http.Protocols{}
 	protocols.SetHTTP1(true)
+	protocols.SetHTTP2(true)
 	protocols.SetUnencryptedHTTP2(true)
 
-	return &http.Server{
+	srv := &http.Server{
 		Addr:              conf.Server.Address,
 		Handler:           router,
 		Protocols:         protocols,
-		ReadHeaderTimeout: 3 * time.Second,
+		ReadTimeout:       conf.Server.ReadTimeout,
+		ReadHeaderTimeout: conf.Server.ReadHeaderTimeout,
+		WriteTimeout:      conf.Server.WriteTimeout,
+		IdleTimeout:       conf.Server.IdleTimeout,
+		MaxHeaderBytes:    int(conf.Server.MaxHeaderBytes),
+	}
+
+	if conf.Server.TLS.CertFile != "" {
+		srv.TLSConfig = newCertReloader(&conf.Server.TLS).tlsConfig()
+	}
+
+	return srv
+}
+
+type requestBodyKey struct{}
+
+// limitRequestBody limits the size of request bodies to maxBytes. The unlimited body is
+// saved in the request context so routes can override the limit with overrideRequestBodyLimit.
+func limitRequestBody(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if maxBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+				r = r.WithContext(context.WithValue(r.Context(), requestBodyKey{}, r.Body))
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// overrideRequestBodyLimit replaces the limit on the size of request bodies set by
+// limitRequestBody with maxBytes, or removes it if maxBytes is 0.
+func overrideRequestBodyLimit(maxBytes int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if body, ok := r.Context().Value(requestBodyKey{}).(io.ReadCloser); ok {
+				r.Body = body
+			}
+			if maxBytes > 0 && r.Body != nil && r.Body != http.NoBody {
+				r.Body = http.MaxBytesReader(w, r.Body, maxBytes)
+			}
+			next.ServeHTTP(w, r)
+		})
 	}
 }
@@ -0,0 +1,147 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	_ "buf.build/gen/go/bufbuild/protovalidate/protocolbuffers/go/buf/validate" // Registers imports of test protos.
+	"github.com/bufbuild/protocompile"
+	"github.com/stretchr/testify/require"
+	_ "google.golang.org/genproto/googleapis/api/annotations" // Registers imports of test protos.
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb" // Registers imports of test protos.
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+func newTestServer(t *testing.T) *Server {
+	t.Helper()
+
+	var conf config.Common
+	require.NoError(t, config.Load(&conf, nil))
+	return newServer(&conf)
+}
+
+func serveTestRequest(s *Server, method string, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	res := httptest.NewRecorder()
+	s.mux.ServeHTTP(res, req)
+	return res
+}
+
+// newTestBooksFileProto compiles testdata/books.proto, keeping its comments. Imports
+// are resolved from the global registry.
+func newTestBooksFileProto(t *testing.T) *descriptorpb.FileDescriptorProto {
+	t.Helper()
+
+	compiler := protocompile.Compiler{
+		Resolver: protocompile.CompositeResolver{
+			&protocompile.SourceResolver{ImportPaths: []string{"testdata"}},
+			protocompile.ResolverFunc(func(path string) (protocompile.SearchResult, error) {
+				fd, err := protoregistry.GlobalFiles.FindFileByPath(path)
+				if err != nil {
+					return protocompile.SearchResult{}, err
+				}
+				return protocompile.SearchResult{Desc: fd}, nil
+			}),
+		},
+		SourceInfoMode: protocompile.SourceInfoStandard,
+	}
+	files, err := compiler.Compile(t.Context(), "books.proto")
+	require.NoError(t, err)
+
+	// Round trip through the wire format so options use the registered extension types,
+	// the same as for generated code.
+	b, err := proto.Marshal(protodesc.ToFileDescriptorProto(files[0]))
+	require.NoError(t, err)
+	var fdp descriptorpb.FileDescriptorProto
+	require.NoError(t, proto.Unmarshal(b, &fdp))
+	return &fdp
+}
+
+// newTestBooksFile returns the descriptor of testdata/books.proto. It is not registered
+// globally so is only used directly or with dynamic messages.
+func newTestBooksFile(t *testing.T) protoreflect.FileDescriptor {
+	t.Helper()
+
+	fd, err := protodesc.NewFile(newTestBooksFileProto(t), protoregistry.GlobalFiles)
+	require.NoError(t, err)
+	return fd
+}
+
+func newTestHTTP2Server(t *testing.T, s *Server) *httptest.Server {
+	t.Helper()
+
+	srv := httptest.NewUnstartedServer(s.mux)
+	srv.EnableHTTP2 = true
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRequestBodyLimit(t *testing.T) {
+	tests := []struct {
+		name      string
+		bodySize  int
+		routeSize int
+
+		status int
+	}{
+		{
+			name:     "under limit",
+			bodySize: 10,
+			status:   http.StatusOK,
+		},
+		{
+			name:     "over limit",
+			bodySize: 11,
+			status:   http.StatusRequestEntityTooLarge,
+		},
+		{
+			name:      "route raises limit",
+			bodySize:  15,
+			routeSize: 20,
+			status:    http.StatusOK,
+		},
+		{
+			name:      "route lowers limit",
+			bodySize:  8,
+			routeSize: 5,
+			status:    http.StatusRequestEntityTooLarge,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var conf config.Common
+			require.NoError(t, config.Load(&conf, nil))
+			conf.Server.MaxRequestBytes = 10
+
+			mux := NewMuxFromConfig(&conf)
+			h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if _, err := io.ReadAll(r.Body); err != nil {
+					w.WriteHeader(http.StatusRequestEntityTooLarge)
+					return
+				}
+				w.WriteHeader(http.StatusOK)
+			})
+			if tc.routeSize > 0 {
+				mux.With(overrideRequestBodyLimit(int64(tc.routeSize))).Post("/upload", h)
+			} else {
+				mux.Post("/upload", h)
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(strings.Repeat("a", tc.bodySize)))
+			res := httptest.NewRecorder()
+			mux.ServeHTTP(res, req)
+			require.Equal(t, tc.status, res.Code)
+		})
+	}
+}
@@ -0,0 +1,261 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// cacheControlImmutable is the Cache-Control for assets with a content hash in their name,
+	// which never change.
+	cacheControlImmutable = "public, max-age=31536000, immutable"
+	// cacheControlRevalidate is the Cache-Control for other files, which must be revalidated
+	// using their ETag.
+	cacheControlRevalidate = "no-cache"
+)
+
+// hashedAssetPattern matches file names with a possible content hash as generated by
+// common bundlers, such as "index-BzXJ3a1f.js" or "main.3f2a1b9c.css".
+var hashedAssetPattern = regexp.MustCompile(`[.-]([A-Za-z0-9_-]{8,})\.[A-Za-z0-9]+$`)
+
+var errNotSeekable = errors.New("file is not seekable")
+
+// StaticOption is a configuration option for ServeStatic.
+type StaticOption interface {
+	apply(h *staticHandler)
+}
+
+// SPAFallback returns a StaticOption to serve index.html at the root of the files for
+// requests to paths that do not exist and do not have a file extension, as needed for
+// single-page apps with client-side routing.
+func SPAFallback() StaticOption {
+	return spaFallbackOption{}
+}
+
+type spaFallbackOption struct{}
+
+func (spaFallbackOption) apply(h *staticHandler) {
+	h.spaFallback = true
+}
+
+// HashedAssets returns a StaticOption to identify files with a content hash in their
+// name with pattern, which is matched against the base name of the file. By default, a
+// hash of at least 8 characters with a digit, separated by '-' or '.' before the
+// extension, is detected as generated by common bundlers such as Vite or webpack.
+func HashedAssets(pattern *regexp.Regexp) StaticOption {
+	return hashedAssetsOption{pattern: pattern}
+}
+
+type hashedAssetsOption struct {
+	pattern *regexp.Regexp
+}
+
+func (o hashedAssetsOption) apply(h *staticHandler) {
+	h.hashed = o.pattern.MatchString
+}
+
+// ServeStatic serves static files, such as a built frontend, at prefix. prefix must
+// begin and end with '/'. Requests for a directory serve its index.html.
+//
+// Files with a content hash in their name are served to be cached forever, while other
+// files are served with an ETag and must be revalidated. If a precompressed variant of
+// a file with an additional .br or .gz extension exists and the client accepts it, it is
+// served instead.
+//
+// Routes registered on the server take precedence. Requests to /internal/ endpoints, to
+// gRPC health and reflection services and to connect services registered on the server
+// are never served static files, so unknown procedures return not found errors instead
+// of e.g. a single-page app's index, even when the service is not mounted.
+func ServeStatic(s *Server, prefix string, files fs.FS, opts ...StaticOption) {
+	if !strings.HasPrefix(prefix, "/") || !strings.HasSuffix(prefix, "/") {
+		panic("prefix must begin and end with /")
+	}
+
+	h := &staticHandler{
+		s:      s,
+		prefix: prefix,
+		files:  files,
+		hashed: isHashedAsset,
+	}
+	for _, o := range opts {
+		o.apply(h)
+	}
+
+	s.mux.Handle(prefix+"*", h)
+}
+
+type staticHandler struct {
+	s      *Server
+	prefix string
+	files  fs.FS
+
+	spaFallback bool
+	hashed      func(name string) bool
+
+	// etags caches the staticETag of files by name.
+	etags sync.Map
+}
+
+// staticETag is the cached ETag of a file, valid while its modification time and size
+// are unchanged. Embedded files have no modification time but never change.
+type staticETag struct {
+	modTime time.Time
+	size    int64
+	etag    string
+}
+
+func (h *staticHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	if h.excluded(r.URL.Path) {
+		http.NotFound(w, r)
+		return
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+strings.TrimPrefix(r.URL.Path, h.prefix)), "/")
+	if name == "" || strings.HasSuffix(r.URL.Path, "/") {
+		name = path.Join(name, "index.html")
+	}
+
+	if !h.exists(name) {
+		if !h.spaFallback || path.Ext(name) != "" {
+			http.NotFound(w, r)
+			return
+		}
+		name = "index.html"
+	}
+
+	if err := h.serveFile(w, r, name); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// excluded returns whether the path is reserved for non-static routes.
+func (h *staticHandler) excluded(p string) bool {
+	return isAdminRoute(p) || h.s.isConnectProcedure(p)
+}
+
+func (h *staticHandler) exists(name string) bool {
+	st, err := fs.Stat(h.files, name)
+	return err == nil && !st.IsDir()
+}
+
+func (h *staticHandler) serveFile(w http.ResponseWriter, r *http.Request, name string) error {
+	servedName := name
+	encoding := ""
+	accept := r.Header.Get("Accept-Encoding")
+	for _, enc := range []struct{ ext, name string }{{".br", "br"}, {".gz", "gzip"}} {
+		if acceptsEncoding(accept, enc.name) && h.exists(name+enc.ext) {
+			servedName = name + enc.ext
+			encoding = enc.name
+			break
+		}
+	}
+
+	f, err := h.files.Open(servedName)
+	if err != nil {
+		return fmt.Errorf("server: opening static file %s: %w", servedName, err)
+	}
+	defer f.Close()
+
+	st, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("server: reading static file %s: %w", servedName, err)
+	}
+
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return fmt.Errorf("server: reading static file %s: %w", servedName, err)
+		}
+		content = bytes.NewReader(b)
+	}
+
+	etag, err := h.etag(servedName, st, content)
+	if err != nil {
+		return err
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Add("Vary", "Accept-Encoding")
+	if ct := mime.TypeByExtension(path.Ext(name)); ct != "" {
+		// Set from the uncompressed name since the type cannot be detected from compressed content.
+		header.Set("Content-Type", ct)
+	}
+	if encoding != "" {
+		header.Set("Content-Encoding", encoding)
+	}
+	if h.hashed(path.Base(name)) {
+		header.Set("Cache-Control", cacheControlImmutable)
+	} else {
+		header.Set("Cache-Control", cacheControlRevalidate)
+	}
+
+	// Embedded files have no modification time, in which case it is not used.
+	http.ServeContent(w, r, name, st.ModTime(), content)
+	return nil
+}
+
+// etag returns the ETag for the file, computed from its content.
+func (h *staticHandler) etag(name string, st fs.FileInfo, content io.ReadSeeker) (string, error) {
+	if v, ok := h.etags.Load(name); ok {
+		cached := v.(*staticETag) //nolint:forcetypeassert // only staticETag is stored
+		if cached.modTime.Equal(st.ModTime()) && cached.size == st.Size() {
+			return cached.etag, nil
+		}
+	}
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, content); err != nil {
+		return "", fmt.Errorf("server: reading static file %s: %w", name, err)
+	}
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return "", fmt.Errorf("server: %w: %s: %w", errNotSeekable, name, err)
+	}
+
+	etag := `"` + hex.EncodeToString(hash.Sum(nil)[:16]) + `"`
+	h.etags.Store(name, &staticETag{modTime: st.ModTime(), size: st.Size(), etag: etag})
+	return etag, nil
+}
+
+// acceptsEncoding returns whether the Accept-Encoding header accepts the encoding.
+func acceptsEncoding(header string, encoding string) bool {
+	for _, e := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(e), ";")
+		if !strings.EqualFold(strings.TrimSpace(name), encoding) {
+			continue
+		}
+		if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if v, err := strconv.ParseFloat(q, 64); err == nil && v == 0 {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isHashedAsset returns whether the file name has a content hash, which is assumed if
+// it matches hashedAssetPattern and the hash contains a digit.
+func isHashedAsset(name string) bool {
+	m := hashedAssetPattern.FindStringSubmatch(name)
+	return m != nil && strings.ContainsAny(m[1], "0123456789")
+}
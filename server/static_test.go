@@ -0,0 +1,220 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestServeStatic(t *testing.T) {
+	files := fstest.MapFS{
+		"index.html":               {Data: []byte("index")},
+		"favicon.ico":              {Data: []byte("icon")},
+		"assets/index-B3xJ9a1f.js": {Data: []byte("script")},
+		"assets/app.css":           {Data: []byte("style")},
+		"assets/app.css.br":        {Data: []byte("style-br")},
+		"assets/app.css.gz":        {Data: []byte("style-gz")},
+		"docs/index.html":          {Data: []byte("docs")},
+	}
+
+	tests := []struct {
+		name           string
+		method         string
+		path           string
+		acceptEncoding string
+		opts           []StaticOption
+
+		status       int
+		body         string
+		cacheControl string
+		encoding     string
+	}{
+		{
+			name:         "root index",
+			path:         "/",
+			status:       http.StatusOK,
+			body:         "index",
+			cacheControl: cacheControlRevalidate,
+		},
+		{
+			name:         "directory index",
+			path:         "/docs/",
+			status:       http.StatusOK,
+			body:         "docs",
+			cacheControl: cacheControlRevalidate,
+		},
+		{
+			name:         "file",
+			path:         "/favicon.ico",
+			status:       http.StatusOK,
+			body:         "icon",
+			cacheControl: cacheControlRevalidate,
+		},
+		{
+			name:         "hashed asset",
+			path:         "/assets/index-B3xJ9a1f.js",
+			status:       http.StatusOK,
+			body:         "script",
+			cacheControl: cacheControlImmutable,
+		},
+		{
+			name:         "hashed asset pattern",
+			path:         "/assets/app.css",
+			opts:         []StaticOption{HashedAssets(regexp.MustCompile(`^app\.`))},
+			status:       http.StatusOK,
+			body:         "style",
+			cacheControl: cacheControlImmutable,
+		},
+		{
+			name:           "brotli",
+			path:           "/assets/app.css",
+			acceptEncoding: "gzip, deflate, br",
+			status:         http.StatusOK,
+			body:           "style-br",
+			cacheControl:   cacheControlRevalidate,
+			encoding:       "br",
+		},
+		{
+			name:           "gzip",
+			path:           "/assets/app.css",
+			acceptEncoding: "gzip, br;q=0",
+			status:         http.StatusOK,
+			body:           "style-gz",
+			cacheControl:   cacheControlRevalidate,
+			encoding:       "gzip",
+		},
+		{
+			name:           "no precompressed variant",
+			path:           "/favicon.ico",
+			acceptEncoding: "gzip, br",
+			status:         http.StatusOK,
+			body:           "icon",
+			cacheControl:   cacheControlRevalidate,
+		},
+		{
+			name:   "not found",
+			path:   "/dashboard",
+			status: http.StatusNotFound,
+		},
+		{
+			name:         "spa fallback",
+			path:         "/dashboard/settings",
+			opts:         []StaticOption{SPAFallback()},
+			status:       http.StatusOK,
+			body:         "index",
+			cacheControl: cacheControlRevalidate,
+		},
+		{
+			name:   "spa fallback missing asset",
+			path:   "/assets/missing.js",
+			opts:   []StaticOption{SPAFallback()},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "spa fallback internal",
+			path:   "/internal/unknown",
+			opts:   []StaticOption{SPAFallback()},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "spa fallback unknown procedure",
+			path:   "/grpc.health.v1.Health/Unknown",
+			opts:   []StaticOption{SPAFallback()},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "spa fallback unmounted reflection",
+			path:   "/grpc.reflection.v1.ServerReflection/ServerReflectionInfo",
+			opts:   []StaticOption{SPAFallback()},
+			status: http.StatusNotFound,
+		},
+		{
+			name:   "post",
+			method: http.MethodPost,
+			path:   "/favicon.ico",
+			status: http.StatusMethodNotAllowed,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+				},
+				nil,
+			)
+			ServeStatic(s, "/", files, tc.opts...)
+
+			method := tc.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			req := httptest.NewRequest(method, tc.path, nil)
+			if tc.acceptEncoding != "" {
+				req.Header.Set("Accept-Encoding", tc.acceptEncoding)
+			}
+			res := httptest.NewRecorder()
+			s.mux.ServeHTTP(res, req)
+
+			require.Equal(t, tc.status, res.Code)
+			if tc.status != http.StatusOK {
+				return
+			}
+			require.Equal(t, tc.body, res.Body.String())
+			require.Equal(t, tc.cacheControl, res.Header().Get("Cache-Control"))
+			require.Equal(t, tc.encoding, res.Header().Get("Content-Encoding"))
+			require.NotEmpty(t, res.Header().Get("ETag"))
+		})
+	}
+}
+
+func TestServeStaticETag(t *testing.T) {
+	s := newTestServer(t)
+	ServeStatic(s, "/app/", fstest.MapFS{
+		"index.html": {Data: []byte("index")},
+	})
+
+	res := serveTestRequest(s, http.MethodGet, "/app/")
+	require.Equal(t, http.StatusOK, res.Code)
+	require.Equal(t, "text/html; charset=utf-8", res.Header().Get("Content-Type"))
+	etag := res.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	req := httptest.NewRequest(http.MethodGet, "/app/index.html", nil)
+	req.Header.Set("If-None-Match", etag)
+	res = httptest.NewRecorder()
+	s.mux.ServeHTTP(res, req)
+	require.Equal(t, http.StatusNotModified, res.Code)
+
+	require.Equal(t, http.StatusNotFound, serveTestRequest(s, http.MethodGet, "/other").Code)
+}
+
+func TestServeStaticETagModified(t *testing.T) {
+	modTime := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	file := &fstest.MapFile{Data: []byte("index"), ModTime: modTime}
+
+	s := newTestServer(t)
+	ServeStatic(s, "/", fstest.MapFS{"index.html": file})
+
+	etag := serveTestRequest(s, http.MethodGet, "/").Header().Get("ETag")
+	require.NotEmpty(t, etag)
+
+	// Same size, as with a file being replaced on disk.
+	file.Data = []byte("INDEX")
+	file.ModTime = modTime.Add(time.Minute)
+
+	res := serveTestRequest(s, http.MethodGet, "/")
+	require.Equal(t, "INDEX", res.Body.String())
+	require.NotEmpty(t, res.Header().Get("ETag"))
+	require.NotEqual(t, etag, res.Header().Get("ETag"))
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"connectrpc.com/connect"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/curioswitch/go-curiostack/config"
+	"github.com/curioswitch/go-curiostack/otel"
+)
+
+var errTimeout = errors.New("procedure timed out")
+
+// timeoutCounter counts connect procedures that exceeded their deadline.
+var timeoutCounter = sync.OnceValue(func() metric.Int64Counter {
+	// Creating an instrument only fails for an invalid name, which is constant here.
+	c, _ := otel.Meter(instrumentationName).Int64Counter(
+		"rpc.server.timeouts",
+		metric.WithDescription("Number of connect procedures that exceeded their deadline."),
+		metric.WithUnit("{timeout}"),
+	)
+	return c
+})
+
+// procedureTimeout returns the configured timeout for the procedure.
+func procedureTimeout(conf *config.Timeouts, procedure string) time.Duration {
+	for _, t := range conf.Procedures {
+		if t.Procedure == procedure {
+			return t.Timeout
+		}
+	}
+	return conf.Default
+}
+
+// timeoutInterceptor bounds the duration of unary procedures, failing with a deadline
+// exceeded error when the deadline of the request passes. The deadline is the earlier
+// of the configured timeout and the deadline set by the client.
+type timeoutInterceptor struct {
+	timeout time.Duration
+}
+
+func (i *timeoutInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		source := "client"
+		if i.timeout > 0 {
+			if d, ok := ctx.Deadline(); !ok || time.Until(d) > i.timeout {
+				source = "server"
+			}
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, i.timeout)
+			defer cancel()
+		}
+
+		res, err := next(ctx, req)
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return res, err
+		}
+
+		timeoutCounter().Add(context.WithoutCancel(ctx), 1, metric.WithAttributes(
+			attribute.String("rpc.method", req.Spec().Procedure),
+			attribute.String("rpc.timeout.source", source),
+		))
+		// Even if the handler succeeded, the response is not returned since the client
+		// has stopped waiting for it.
+		return nil, connect.NewError(connect.CodeDeadlineExceeded, errTimeout)
+	}
+}
+
+func (i *timeoutInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *timeoutInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return next
+}
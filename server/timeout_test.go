@@ -0,0 +1,162 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+func TestHandleConnectUnaryTimeout(t *testing.T) {
+	tests := []struct {
+		name          string
+		timeouts      config.Timeouts
+		clientTimeout time.Duration
+		ignoreContext bool
+
+		code connect.Code
+	}{
+		{
+			name:     "no timeout",
+			timeouts: config.Timeouts{},
+		},
+		{
+			name:     "within default",
+			timeouts: config.Timeouts{Default: time.Second},
+		},
+		{
+			name:     "exceeds default",
+			timeouts: config.Timeouts{Default: 10 * time.Millisecond},
+			code:     connect.CodeDeadlineExceeded,
+		},
+		{
+			name:          "exceeds default, handler ignores context",
+			timeouts:      config.Timeouts{Default: 10 * time.Millisecond},
+			ignoreContext: true,
+			code:          connect.CodeDeadlineExceeded,
+		},
+		{
+			name: "procedure overrides default",
+			timeouts: config.Timeouts{
+				Default: 10 * time.Millisecond,
+				Procedures: []config.ProcedureTimeout{
+					{Procedure: healthpb.Health_Check_FullMethodName, Timeout: time.Second},
+				},
+			},
+		},
+		{
+			name: "procedure disables timeout",
+			timeouts: config.Timeouts{
+				Default: 10 * time.Millisecond,
+				Procedures: []config.ProcedureTimeout{
+					{Procedure: healthpb.Health_Check_FullMethodName, Timeout: 0},
+				},
+			},
+		},
+		{
+			name: "other procedure",
+			timeouts: config.Timeouts{
+				Default: time.Second,
+				Procedures: []config.ProcedureTimeout{
+					{Procedure: healthpb.Health_List_FullMethodName, Timeout: 10 * time.Millisecond},
+				},
+			},
+		},
+		{
+			name:          "client deadline shorter",
+			timeouts:      config.Timeouts{Default: time.Second},
+			clientTimeout: 10 * time.Millisecond,
+			code:          connect.CodeDeadlineExceeded,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := newTestServer(t)
+			s.conf.Server.Timeouts = tc.timeouts
+
+			HandleConnectUnary(s,
+				healthpb.Health_Check_FullMethodName,
+				func(ctx context.Context, _ *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+					if tc.ignoreContext {
+						time.Sleep(50 * time.Millisecond)
+					} else {
+						select {
+						case <-ctx.Done():
+							return nil, ctx.Err()
+						case <-time.After(50 * time.Millisecond):
+						}
+					}
+					return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+				},
+				nil,
+			)
+
+			srv := httptest.NewServer(s.mux)
+			defer srv.Close()
+
+			ctx := t.Context()
+			if tc.clientTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.clientTimeout)
+				defer cancel()
+			}
+
+			client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+				http.DefaultClient,
+				srv.URL+healthpb.Health_Check_FullMethodName,
+			)
+			res, err := client.CallUnary(ctx, connect.NewRequest(&healthpb.HealthCheckRequest{}))
+			if tc.code != 0 {
+				require.Equal(t, tc.code, connect.CodeOf(err))
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, healthpb.HealthCheckResponse_SERVING, res.Msg.GetStatus())
+		})
+	}
+}
+
+func TestHandleConnectUnaryTimeoutBoundsAuth(t *testing.T) {
+	// The key set is never returned, so verifying tokens blocks until the request is done.
+	jwks := httptest.NewServer(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer jwks.Close()
+
+	iss := newTestIssuer(t)
+	iss.url = jwks.URL
+
+	s := newTestServer(t)
+	s.conf.Server.Timeouts = config.Timeouts{Default: 10 * time.Millisecond}
+	s.jwtAuth = newJWTAuth(&config.Auth{Issuers: []config.Issuer{
+		{Issuer: jwks.URL, JWKSURL: jwks.URL + "/jwks", Audiences: []string{"my-service"}},
+	}})
+
+	HandleConnectUnary(s,
+		healthpb.Health_Check_FullMethodName,
+		func(context.Context, *healthpb.HealthCheckRequest) (*healthpb.HealthCheckResponse, error) {
+			return &healthpb.HealthCheckResponse{Status: healthpb.HealthCheckResponse_SERVING}, nil
+		},
+		nil,
+	)
+
+	srv := httptest.NewServer(s.mux)
+	defer srv.Close()
+
+	client := connect.NewClient[healthpb.HealthCheckRequest, healthpb.HealthCheckResponse](
+		http.DefaultClient,
+		srv.URL+healthpb.Health_Check_FullMethodName,
+	)
+	req := connect.NewRequest(&healthpb.HealthCheckRequest{})
+	req.Header().Set("Authorization", "Bearer "+iss.token(t, "my-service", nil))
+	_, err := client.CallUnary(t.Context(), req)
+	require.Equal(t, connect.CodeDeadlineExceeded, connect.CodeOf(err))
+}
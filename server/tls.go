@@ -0,0 +1,155 @@
+package server
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+// tlsReloadInterval is how often certificate files are checked for changes.
+const tlsReloadInterval = 10 * time.Second
+
+var (
+	errInvalidTLSVersion = errors.New("invalid TLS version")
+	errNoClientCAs       = errors.New("no certificates found in client CA file")
+)
+
+// certReloader provides TLS configuration based on certificate files, reloading
+// them when they are changed on disk. Changes are detected by checking the modification
+// time of the files, at most once every checkInterval.
+type certReloader struct {
+	conf          *config.TLS
+	checkInterval time.Duration
+
+	mu        sync.Mutex
+	current   *tls.Config
+	modTimes  []time.Time
+	checkedAt time.Time
+}
+
+func newCertReloader(conf *config.TLS) *certReloader {
+	return &certReloader{
+		conf:          conf,
+		checkInterval: tlsReloadInterval,
+	}
+}
+
+// tlsConfig returns a [tls.Config] for a server that uses the reloaded configuration
+// for each connection.
+func (r *certReloader) tlsConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			return r.config()
+		},
+	}
+}
+
+func (r *certReloader) config() (*tls.Config, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.current != nil && time.Since(r.checkedAt) < r.checkInterval {
+		return r.current, nil
+	}
+
+	modTimes, err := r.statFiles()
+	if err != nil {
+		if r.current != nil {
+			// Files may be temporarily missing while being replaced, keep serving
+			// with the previous configuration.
+			return r.current, nil
+		}
+		return nil, err
+	}
+	r.checkedAt = time.Now()
+
+	if r.current != nil && slices.EqualFunc(modTimes, r.modTimes, time.Time.Equal) {
+		return r.current, nil
+	}
+
+	c, err := r.load()
+	if err != nil {
+		if r.current != nil {
+			slog.Warn("Failed to reload TLS configuration, continuing with previous configuration", "error", err)
+			return r.current, nil
+		}
+		return nil, err
+	}
+	r.current = c
+	r.modTimes = modTimes
+	return c, nil
+}
+
+func (r *certReloader) files() []string {
+	files := []string{r.conf.CertFile, r.conf.KeyFile}
+	if r.conf.ClientCAFile != "" {
+		files = append(files, r.conf.ClientCAFile)
+	}
+	return files
+}
+
+func (r *certReloader) statFiles() ([]time.Time, error) {
+	files := r.files()
+	modTimes := make([]time.Time, len(files))
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("server: stat TLS file: %w", err)
+		}
+		modTimes[i] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+func (r *certReloader) load() (*tls.Config, error) {
+	minVersion, err := parseTLSVersion(r.conf.MinVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.conf.CertFile, r.conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("server: loading TLS certificate: %w", err)
+	}
+
+	c := &tls.Config{
+		MinVersion:   minVersion,
+		Certificates: []tls.Certificate{cert},
+		NextProtos:   []string{"h2", "http/1.1"},
+	}
+
+	if r.conf.ClientCAFile != "" {
+		caPEM, err := os.ReadFile(r.conf.ClientCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("server: reading client CA file: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(caPEM) {
+			return nil, errNoClientCAs
+		}
+		c.ClientCAs = pool
+		c.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return c, nil
+}
+
+func parseTLSVersion(v string) (uint16, error) {
+	switch v {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("server: %w: %s", errInvalidTLSVersion, v)
+	}
+}
@@ -0,0 +1,152 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/curioswitch/go-curiostack/config"
+)
+
+func TestCertReloader(t *testing.T) {
+	dir := t.TempDir()
+	conf := &config.TLS{
+		CertFile: filepath.Join(dir, "cert.pem"),
+		KeyFile:  filepath.Join(dir, "key.pem"),
+	}
+
+	writeTestCert(t, conf.CertFile, conf.KeyFile, "first", time.Now().Add(-time.Minute))
+
+	r := newCertReloader(conf)
+	r.checkInterval = 0
+
+	c, err := r.config()
+	require.NoError(t, err)
+	require.Equal(t, "first", leafCommonName(t, c))
+	require.Equal(t, uint16(tls.VersionTLS12), c.MinVersion)
+	require.Equal(t, tls.NoClientCert, c.ClientAuth)
+
+	// Unchanged files reuse the loaded config.
+	c2, err := r.config()
+	require.NoError(t, err)
+	require.Same(t, c, c2)
+
+	writeTestCert(t, conf.CertFile, conf.KeyFile, "second", time.Now())
+
+	c, err = r.config()
+	require.NoError(t, err)
+	require.Equal(t, "second", leafCommonName(t, c))
+
+	// Broken files keep serving the previous certificate.
+	require.NoError(t, os.WriteFile(conf.KeyFile, []byte("broken"), 0o600))
+	require.NoError(t, os.Chtimes(conf.KeyFile, time.Now().Add(time.Minute), time.Now().Add(time.Minute)))
+	c, err = r.config()
+	require.NoError(t, err)
+	require.Equal(t, "second", leafCommonName(t, c))
+}
+
+func TestCertReloaderClientCA(t *testing.T) {
+	dir := t.TempDir()
+	conf := &config.TLS{
+		CertFile:     filepath.Join(dir, "cert.pem"),
+		KeyFile:      filepath.Join(dir, "key.pem"),
+		ClientCAFile: filepath.Join(dir, "cert.pem"),
+		MinVersion:   "1.3",
+	}
+	writeTestCert(t, conf.CertFile, conf.KeyFile, "server", time.Now())
+
+	c, err := newCertReloader(conf).config()
+	require.NoError(t, err)
+	require.Equal(t, uint16(tls.VersionTLS13), c.MinVersion)
+	require.Equal(t, tls.RequireAndVerifyClientCert, c.ClientAuth)
+	require.NotNil(t, c.ClientCAs)
+}
+
+func TestCertReloaderErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	keyFile := filepath.Join(dir, "key.pem")
+	writeTestCert(t, certFile, keyFile, "server", time.Now())
+
+	tests := []struct {
+		name string
+		conf config.TLS
+	}{
+		{
+			name: "missing files",
+			conf: config.TLS{
+				CertFile: filepath.Join(dir, "missing.pem"),
+				KeyFile:  keyFile,
+			},
+		},
+		{
+			name: "invalid version",
+			conf: config.TLS{
+				CertFile:   certFile,
+				KeyFile:    keyFile,
+				MinVersion: "1.0",
+			},
+		},
+		{
+			name: "invalid client CA",
+			conf: config.TLS{
+				CertFile:     certFile,
+				KeyFile:      keyFile,
+				ClientCAFile: keyFile,
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := newCertReloader(&tc.conf).config()
+			require.Error(t, err)
+		})
+	}
+}
+
+func writeTestCert(t *testing.T, certFile string, keyFile string, commonName string, modTime time.Time) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: commonName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func leafCommonName(t *testing.T, c *tls.Config) string {
+	t.Helper()
+
+	require.Len(t, c.Certificates, 1)
+	leaf, err := x509.ParseCertificate(c.Certificates[0].Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
@@ -0,0 +1,573 @@
+package server
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"connectrpc.com/connect"
+	"github.com/go-chi/chi/v5"
+	"google.golang.org/genproto/googleapis/api/annotations"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+var (
+	errInvalidPathTemplate = errors.New("invalid path template")
+	errUnknownField        = errors.New("unknown field")
+	errUnsupportedField    = errors.New("field cannot be set from a path or query parameter")
+)
+
+// restRoute is a REST route transcoded to a connect unary procedure based on a
+// google.api.http annotation.
+type restRoute struct {
+	procedure  string
+	method     protoreflect.MethodDescriptor
+	httpMethod string
+	path       *pathTemplate
+
+	// body is the request field the HTTP body is mapped to, or nil if there is no body
+	// or it is mapped to the entire request.
+	body protoreflect.FieldDescriptor
+	// bodyAll is set when the entire request is mapped from the HTTP body.
+	bodyAll bool
+	// responseBody is the response field to return as the HTTP body, or nil to return
+	// the entire response.
+	responseBody protoreflect.FieldDescriptor
+
+	handler http.Handler
+}
+
+// mountRESTRoutes mounts REST routes for any google.api.http annotations on method
+// which invoke the connect handler h.
+func mountRESTRoutes(s *Server, procedure string, method protoreflect.MethodDescriptor, h http.Handler, opts []connect.HandlerOption) {
+	rule, ok := proto.GetExtension(method.Options(), annotations.E_Http).(*annotations.HttpRule)
+	if !ok || rule == nil {
+		return
+	}
+
+	rules := append([]*annotations.HttpRule{rule}, rule.GetAdditionalBindings()...)
+	mux := s.mux.With(procedureMiddlewares(opts)...)
+	for _, rule := range rules {
+		route, err := newRESTRoute(procedure, method, rule, h)
+		if err != nil {
+			panic(fmt.Sprintf("invalid google.api.http annotation on %s: %v", procedure, err))
+		}
+		mux.Method(route.httpMethod, route.path.pattern, route)
+		s.restRoutes = append(s.restRoutes, route)
+	}
+}
+
+func newRESTRoute(procedure string, method protoreflect.MethodDescriptor, rule *annotations.HttpRule, h http.Handler) (*restRoute, error) {
+	httpMethod, tmpl := httpRulePattern(rule)
+	if httpMethod == "" {
+		return nil, fmt.Errorf("server: %w: missing pattern", errInvalidPathTemplate)
+	}
+
+	path, err := parsePathTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	for i, v := range path.vars {
+		fields, err := resolveFieldPath(method.Input(), v.fieldPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkParamField(fields[len(fields)-1]); err != nil {
+			return nil, err
+		}
+		path.vars[i].fields = fields
+	}
+
+	route := &restRoute{
+		procedure:  procedure,
+		method:     method,
+		httpMethod: httpMethod,
+		path:       path,
+		handler:    h,
+	}
+
+	switch b := rule.GetBody(); b {
+	case "":
+	case "*":
+		route.bodyAll = true
+	default:
+		fd := method.Input().Fields().ByName(protoreflect.Name(b))
+		if fd == nil {
+			return nil, fmt.Errorf("server: body %s: %w", b, errUnknownField)
+		}
+		route.body = fd
+	}
+
+	if rb := rule.GetResponseBody(); rb != "" {
+		fd := method.Output().Fields().ByName(protoreflect.Name(rb))
+		if fd == nil {
+			return nil, fmt.Errorf("server: response body %s: %w", rb, errUnknownField)
+		}
+		route.responseBody = fd
+	}
+
+	return route, nil
+}
+
+func httpRulePattern(rule *annotations.HttpRule) (string, string) {
+	switch p := rule.GetPattern().(type) {
+	case *annotations.HttpRule_Get:
+		return http.MethodGet, p.Get
+	case *annotations.HttpRule_Put:
+		return http.MethodPut, p.Put
+	case *annotations.HttpRule_Post:
+		return http.MethodPost, p.Post
+	case *annotations.HttpRule_Delete:
+		return http.MethodDelete, p.Delete
+	case *annotations.HttpRule_Patch:
+		return http.MethodPatch, p.Patch
+	case *annotations.HttpRule_Custom:
+		return p.Custom.GetKind(), p.Custom.GetPath()
+	}
+	return "", ""
+}
+
+// ServeHTTP builds the request message from the HTTP request and invokes the connect
+// handler with it as a unary JSON request, so all interceptors apply as normal.
+func (t *restRoute) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	req, err := t.buildRequest(r)
+	if err != nil {
+		_ = connect.NewErrorWriter().Write(w, r, connect.NewError(connect.CodeInvalidArgument, err))
+		return
+	}
+
+	reqJSON, err := protojson.Marshal(req)
+	if err != nil {
+		_ = connect.NewErrorWriter().Write(w, r, connect.NewError(connect.CodeInternal, err))
+		return
+	}
+
+	creq := r.Clone(r.Context())
+	creq.Method = http.MethodPost
+	creq.URL = &url.URL{Path: t.procedure}
+	creq.RequestURI = t.procedure
+	creq.Body = io.NopCloser(bytes.NewReader(reqJSON))
+	creq.ContentLength = int64(len(reqJSON))
+	creq.Header.Set("Content-Type", "application/json")
+	creq.Header.Set("Connect-Protocol-Version", "1")
+	creq.Header.Del("Content-Encoding")
+	creq.Header.Del("Content-Length")
+	// Responses are passed through or re-encoded so must not be compressed.
+	creq.Header.Del("Accept-Encoding")
+
+	if t.responseBody == nil {
+		t.handler.ServeHTTP(w, creq)
+		return
+	}
+
+	rec := &bufferedResponseWriter{header: w.Header(), status: http.StatusOK}
+	t.handler.ServeHTTP(rec, creq)
+	if rec.status != http.StatusOK {
+		w.WriteHeader(rec.status)
+		_, _ = w.Write(rec.body.Bytes())
+		return
+	}
+
+	body, err := t.extractResponseBody(rec.body.Bytes())
+	if err != nil {
+		_ = connect.NewErrorWriter().Write(w, r, connect.NewError(connect.CodeInternal, err))
+		return
+	}
+	w.Header().Del("Content-Length")
+	_, _ = w.Write(body)
+}
+
+func (t *restRoute) buildRequest(r *http.Request) (proto.Message, error) {
+	req := dynamicpb.NewMessage(t.method.Input())
+
+	if t.bodyAll || t.body != nil {
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, fmt.Errorf("server: reading request body: %w", err)
+		}
+		if len(bytes.TrimSpace(body)) > 0 {
+			if t.body != nil {
+				// Wrap the body in an object so protojson handles decoding of any field type.
+				body, err = json.Marshal(map[string]json.RawMessage{t.body.JSONName(): body})
+				if err != nil {
+					return nil, fmt.Errorf("server: invalid request body: %w", err)
+				}
+			}
+			if err := protojson.Unmarshal(body, req); err != nil {
+				return nil, fmt.Errorf("server: invalid request body: %w", err)
+			}
+		}
+	}
+
+	for _, v := range t.path.vars {
+		value, err := v.value(r)
+		if err != nil {
+			return nil, err
+		}
+		if err := setField(req, v.fields, []string{value}); err != nil {
+			return nil, fmt.Errorf("server: path parameter %s: %w", v.fieldPath, err)
+		}
+	}
+
+	if t.bodyAll {
+		return req, nil
+	}
+
+	for key, values := range r.URL.Query() {
+		fields, err := resolveFieldPath(t.method.Input(), key)
+		if err != nil {
+			// Unknown query parameters, e.g. for cache busting, are ignored.
+			continue
+		}
+		// Fields bound to the path or body, by either their proto or JSON name, cannot be
+		// overridden by query parameters.
+		if fields[0] == t.body || slices.ContainsFunc(t.path.vars, func(v pathVariable) bool {
+			return slices.Equal(v.fields, fields)
+		}) {
+			continue
+		}
+		if err := setField(req, fields, values); err != nil {
+			return nil, fmt.Errorf("server: query parameter %s: %w", key, err)
+		}
+	}
+
+	return req, nil
+}
+
+func (t *restRoute) extractResponseBody(body []byte) ([]byte, error) {
+	resp := dynamicpb.NewMessage(t.method.Output())
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(body, resp); err != nil {
+		return nil, fmt.Errorf("server: parsing response: %w", err)
+	}
+	full, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+	if err != nil {
+		return nil, fmt.Errorf("server: marshaling response: %w", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(full, &fields); err != nil {
+		return nil, fmt.Errorf("server: parsing response: %w", err)
+	}
+	return fields[t.responseBody.JSONName()], nil
+}
+
+// bufferedResponseWriter buffers a response body to allow it to be transformed.
+type bufferedResponseWriter struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponseWriter) Write(b []byte) (int, error) {
+	return w.body.Write(b) //nolint:wrapcheck // bytes.Buffer never returns an error
+}
+
+func (w *bufferedResponseWriter) WriteHeader(status int) {
+	w.status = status
+}
+
+// resolveFieldPath resolves a dot-separated field path within msg. Fields can be
+// referred to by either their proto or JSON names.
+func resolveFieldPath(msg protoreflect.MessageDescriptor, path string) ([]protoreflect.FieldDescriptor, error) {
+	parts := strings.Split(path, ".")
+	fields := make([]protoreflect.FieldDescriptor, len(parts))
+	for i, p := range parts {
+		if msg == nil {
+			return nil, fmt.Errorf("server: %s: %w", path, errUnknownField)
+		}
+		fd := msg.Fields().ByName(protoreflect.Name(p))
+		if fd == nil {
+			fd = msg.Fields().ByJSONName(p)
+		}
+		if fd == nil {
+			return nil, fmt.Errorf("server: %s: %w", path, errUnknownField)
+		}
+		fields[i] = fd
+		msg = nil
+		if fd.Kind() == protoreflect.MessageKind && !fd.IsList() && !fd.IsMap() {
+			msg = fd.Message()
+		}
+	}
+	return fields, nil
+}
+
+func checkParamField(fd protoreflect.FieldDescriptor) error {
+	if fd.IsMap() || fd.Kind() == protoreflect.MessageKind || fd.Kind() == protoreflect.GroupKind {
+		return fmt.Errorf("server: %s: %w", fd.FullName(), errUnsupportedField)
+	}
+	return nil
+}
+
+// setField sets the field at the resolved path in msg from the string values of
+// a path or query parameter.
+func setField(msg protoreflect.Message, fields []protoreflect.FieldDescriptor, values []string) error {
+	for _, fd := range fields[:len(fields)-1] {
+		msg = msg.Mutable(fd).Message()
+	}
+	fd := fields[len(fields)-1]
+	if err := checkParamField(fd); err != nil {
+		return err
+	}
+
+	if fd.IsList() {
+		list := msg.Mutable(fd).List()
+		for _, s := range values {
+			v, err := parseParamValue(fd, s)
+			if err != nil {
+				return err
+			}
+			list.Append(v)
+		}
+		return nil
+	}
+
+	v, err := parseParamValue(fd, values[len(values)-1])
+	if err != nil {
+		return err
+	}
+	msg.Set(fd, v)
+	return nil
+}
+
+func parseParamValue(fd protoreflect.FieldDescriptor, s string) (protoreflect.Value, error) {
+	var v protoreflect.Value
+	var err error
+	switch fd.Kind() {
+	case protoreflect.StringKind:
+		v = protoreflect.ValueOfString(s)
+	case protoreflect.BytesKind:
+		var b []byte
+		b, err = base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			b, err = base64.URLEncoding.DecodeString(s)
+		}
+		v = protoreflect.ValueOfBytes(b)
+	case protoreflect.BoolKind:
+		var b bool
+		b, err = strconv.ParseBool(s)
+		v = protoreflect.ValueOfBool(b)
+	case protoreflect.Int32Kind, protoreflect.Sint32Kind, protoreflect.Sfixed32Kind:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 32)
+		v = protoreflect.ValueOfInt32(int32(n))
+	case protoreflect.Int64Kind, protoreflect.Sint64Kind, protoreflect.Sfixed64Kind:
+		var n int64
+		n, err = strconv.ParseInt(s, 10, 64)
+		v = protoreflect.ValueOfInt64(n)
+	case protoreflect.Uint32Kind, protoreflect.Fixed32Kind:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 32)
+		v = protoreflect.ValueOfUint32(uint32(n))
+	case protoreflect.Uint64Kind, protoreflect.Fixed64Kind:
+		var n uint64
+		n, err = strconv.ParseUint(s, 10, 64)
+		v = protoreflect.ValueOfUint64(n)
+	case protoreflect.FloatKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 32)
+		v = protoreflect.ValueOfFloat32(float32(f))
+	case protoreflect.DoubleKind:
+		var f float64
+		f, err = strconv.ParseFloat(s, 64)
+		v = protoreflect.ValueOfFloat64(f)
+	case protoreflect.EnumKind:
+		if ev := fd.Enum().Values().ByName(protoreflect.Name(s)); ev != nil {
+			v = protoreflect.ValueOfEnum(ev.Number())
+		} else {
+			var n int64
+			n, err = strconv.ParseInt(s, 10, 32)
+			v = protoreflect.ValueOfEnum(protoreflect.EnumNumber(n))
+		}
+	default:
+		return protoreflect.Value{}, fmt.Errorf("server: %s: %w", fd.FullName(), errUnsupportedField)
+	}
+	if err != nil {
+		return protoreflect.Value{}, fmt.Errorf("server: invalid value %q for %s: %w", s, fd.FullName(), err)
+	}
+	return v, nil
+}
+
+// pathTemplate is a parsed google.api.http path template.
+type pathTemplate struct {
+	// pattern is the equivalent chi route pattern.
+	pattern string
+	// docsPath is the template with variable patterns removed, for display in docs.
+	docsPath string
+
+	vars []pathVariable
+}
+
+// pathVariable is a variable in a path template bound to a request field.
+type pathVariable struct {
+	fieldPath string
+	fields    []protoreflect.FieldDescriptor
+
+	// segments are the parts of the path making up the variable's value, joined by "/".
+	segments []templateSegment
+}
+
+// templateSegment is either a literal path segment or a reference to a chi URL param.
+type templateSegment struct {
+	literal string
+	param   string
+}
+
+func (v *pathVariable) value(r *http.Request) (string, error) {
+	parts := make([]string, len(v.segments))
+	for i, s := range v.segments {
+		if s.param == "" {
+			parts[i] = s.literal
+			continue
+		}
+		p := chi.URLParam(r, s.param)
+		// chi routes on the escaped path only when it differs from the default encoding
+		// of the unescaped path, e.g. when it contains %2F, and params are otherwise
+		// already unescaped.
+		if r.URL.RawPath != "" {
+			var err error
+			if p, err = url.PathUnescape(p); err != nil {
+				return "", fmt.Errorf("server: path parameter %s: %w", v.fieldPath, err)
+			}
+		}
+		parts[i] = p
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// parsePathTemplate parses a path template as defined in google/api/http.proto
+// into a chi route pattern.
+//
+//	Template = "/" Segments [ Verb ] ;
+//	Segments = Segment { "/" Segment } ;
+//	Segment  = "*" | "**" | LITERAL | Variable ;
+//	Variable = "{" FieldPath [ "=" Segments ] "}" ;
+//	Verb     = ":" LITERAL ;
+func parsePathTemplate(tmpl string) (*pathTemplate, error) {
+	path, ok := strings.CutPrefix(tmpl, "/")
+	if !ok {
+		return nil, fmt.Errorf("server: %w: %s must start with /", errInvalidPathTemplate, tmpl)
+	}
+
+	segments, err := splitTemplateSegments(path)
+	if err != nil {
+		return nil, fmt.Errorf("server: %w: %s", errInvalidPathTemplate, tmpl)
+	}
+
+	var verb string
+	if last := segments[len(segments)-1]; !strings.HasSuffix(last, "}") {
+		if i := strings.LastIndexByte(last, ':'); i >= 0 {
+			segments[len(segments)-1], verb = last[:i], last[i:]
+		}
+	} else if i := strings.LastIndex(last, "}:"); i >= 0 {
+		segments[len(segments)-1], verb = last[:i+1], last[i+1:]
+	}
+
+	res := &pathTemplate{}
+	var pattern, docsPath []string
+	numParams := 0
+	wildcard := false
+	// convert converts a non-variable segment to a chi pattern segment.
+	convert := func(seg string) (string, templateSegment, error) {
+		if wildcard {
+			return "", templateSegment{}, fmt.Errorf("server: %w: %s, ** must be the last segment", errInvalidPathTemplate, tmpl)
+		}
+		switch {
+		case seg == "**":
+			wildcard = true
+			return "*", templateSegment{param: "*"}, nil
+		case seg == "*":
+			name := "p" + strconv.Itoa(numParams)
+			numParams++
+			return "{" + name + "}", templateSegment{param: name}, nil
+		case seg == "" || strings.ContainsAny(seg, "{}*:"):
+			return "", templateSegment{}, fmt.Errorf("server: %w: %s", errInvalidPathTemplate, tmpl)
+		default:
+			return seg, templateSegment{literal: seg}, nil
+		}
+	}
+
+	for _, seg := range segments {
+		varDef, isVar := strings.CutPrefix(seg, "{")
+		if isVar && !strings.HasSuffix(varDef, "}") {
+			return nil, fmt.Errorf("server: %w: %s", errInvalidPathTemplate, tmpl)
+		}
+		if !isVar {
+			p, _, err := convert(seg)
+			if err != nil {
+				return nil, err
+			}
+			pattern = append(pattern, p)
+			docsPath = append(docsPath, seg)
+			continue
+		}
+
+		fieldPath, varTmpl, hasTmpl := strings.Cut(strings.TrimSuffix(varDef, "}"), "=")
+		if !hasTmpl {
+			varTmpl = "*"
+		}
+		v := pathVariable{fieldPath: fieldPath}
+		for s := range strings.SplitSeq(varTmpl, "/") {
+			p, ts, err := convert(s)
+			if err != nil {
+				return nil, err
+			}
+			pattern = append(pattern, p)
+			v.segments = append(v.segments, ts)
+		}
+		res.vars = append(res.vars, v)
+		docsPath = append(docsPath, "{"+fieldPath+"}")
+	}
+
+	if verb != "" {
+		if wildcard {
+			return nil, fmt.Errorf("server: %w: %s, ** cannot be followed by a verb", errInvalidPathTemplate, tmpl)
+		}
+		pattern[len(pattern)-1] += verb
+		docsPath[len(docsPath)-1] += verb
+	}
+
+	res.pattern = "/" + strings.Join(pattern, "/")
+	res.docsPath = "/" + strings.Join(docsPath, "/")
+	return res, nil
+}
+
+// splitTemplateSegments splits path on "/" outside of variables.
+func splitTemplateSegments(path string) ([]string, error) {
+	var segments []string
+	depth := 0
+	start := 0
+	for i, c := range path {
+		switch c {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segments = append(segments, path[start:i])
+				start = i + 1
+			}
+		}
+		if depth < 0 || depth > 1 {
+			return nil, errInvalidPathTemplate
+		}
+	}
+	if depth != 0 {
+		return nil, errInvalidPathTemplate
+	}
+	return append(segments, path[start:]), nil
+}
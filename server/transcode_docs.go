@@ -0,0 +1,140 @@
+package server
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/curioswitch/go-docs-handler/specification"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// restDocsPlugin is a docs handler plugin that documents REST routes transcoded from
+// google.api.http annotations. Types are documented by the proto plugin so are not
+// included.
+type restDocsPlugin struct {
+	routes []*restRoute
+}
+
+func (p *restDocsPlugin) GenerateSpecification() (*specification.Specification, error) {
+	spec := &specification.Specification{}
+	services := map[protoreflect.FullName]int{}
+	ids := map[string]int{}
+
+	for _, r := range p.routes {
+		svc := r.method.Parent().FullName()
+		idx, ok := services[svc]
+		if !ok {
+			idx = len(spec.Services)
+			services[svc] = idx
+			spec.Services = append(spec.Services, specification.Service{
+				Name:            string(svc) + " (REST)",
+				DescriptionInfo: specification.DescriptionInfo{Markup: "NONE"},
+			})
+		}
+
+		// Additional bindings of a method may share the same HTTP method.
+		baseID := r.procedure[1:] + "/" + r.httpMethod
+		id := baseID
+		if n := ids[baseID]; n > 0 {
+			id += strconv.Itoa(n)
+		}
+		ids[baseID]++
+
+		spec.Services[idx].Methods = append(spec.Services[idx].Methods, specification.Method{
+			Name:                string(r.method.Name()),
+			ID:                  id,
+			ReturnTypeSignature: r.returnTypeSignature(),
+			Parameters:          r.docsParameters(),
+			Endpoints: []specification.Endpoint{
+				{
+					HostnamePattern:    "*",
+					PathMapping:        r.path.docsPath,
+					DefaultMimeType:    "application/json",
+					AvailableMimeTypes: []string{"application/json"},
+				},
+			},
+			HTTPMethod:      r.httpMethod,
+			DescriptionInfo: specification.DescriptionInfo{Markup: "NONE"},
+		})
+	}
+
+	return spec, nil
+}
+
+func (t *restRoute) returnTypeSignature() specification.TypeSignature {
+	if t.responseBody != nil {
+		return docsTypeSignature(t.responseBody)
+	}
+	return specification.NewStructTypeSignature(string(t.method.Output().FullName()))
+}
+
+func (t *restRoute) docsParameters() []specification.Field {
+	var params []specification.Field
+	bound := map[protoreflect.FieldDescriptor]bool{}
+	for _, v := range t.path.vars {
+		fd := v.fields[len(v.fields)-1]
+		params = append(params, docsField(v.fieldPath, fd, specification.FieldLocationPath, "REQUIRED"))
+		bound[v.fields[0]] = true
+	}
+
+	fields := t.method.Input().Fields()
+	for i := range fields.Len() {
+		fd := fields.Get(i)
+		if bound[fd] && fd.Kind() != protoreflect.MessageKind {
+			continue
+		}
+		switch {
+		case t.bodyAll, t.body == fd:
+			params = append(params, docsField(string(fd.Name()), fd, specification.FieldLocationBody, "OPTIONAL"))
+		case t.body == nil && checkParamField(fd) == nil:
+			params = append(params, docsField(string(fd.Name()), fd, specification.FieldLocationQuery, "OPTIONAL"))
+		}
+	}
+	return params
+}
+
+func docsField(name string, fd protoreflect.FieldDescriptor, loc specification.FieldLocation, requirement string) specification.Field {
+	return specification.Field{
+		Name:            name,
+		Location:        loc,
+		Requirement:     requirement,
+		TypeSignature:   docsTypeSignature(fd),
+		DescriptionInfo: specification.DescriptionInfo{Markup: "NONE"},
+	}
+}
+
+func docsTypeSignature(fd protoreflect.FieldDescriptor) specification.TypeSignature {
+	if fd.IsMap() {
+		return specification.NewMapTypeSignature(docsTypeSignature(fd.MapKey()), docsTypeSignature(fd.MapValue()))
+	}
+
+	var sig specification.TypeSignature
+	switch fd.Kind() {
+	case protoreflect.MessageKind, protoreflect.GroupKind:
+		sig = specification.NewStructTypeSignature(string(fd.Message().FullName()))
+	case protoreflect.EnumKind:
+		sig = specification.NewEnumTypeSignature(string(fd.Enum().FullName()))
+	default:
+		sig = baseTypeSignature(fd.Kind().String())
+	}
+
+	if fd.IsList() {
+		sig = specification.NewIterableTypeSignature("repeated", sig)
+	}
+	return sig
+}
+
+// baseTypeSignature is a type signature for a scalar type, such as "string".
+type baseTypeSignature string
+
+func (s baseTypeSignature) Type() specification.TypeSignatureType {
+	return specification.TypeSignatureTypeBase
+}
+
+func (s baseTypeSignature) Signature() string {
+	return string(s)
+}
+
+func (s baseTypeSignature) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(s)) //nolint:wrapcheck // marshaling a string never fails
+}
@@ -0,0 +1,228 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestParsePathTemplate(t *testing.T) {
+	tests := []struct {
+		tmpl string
+
+		pattern  string
+		docsPath string
+		vars     []string
+		err      bool
+	}{
+		{
+			tmpl:     "/v1/books",
+			pattern:  "/v1/books",
+			docsPath: "/v1/books",
+		},
+		{
+			tmpl:     "/v1/books/{id}",
+			pattern:  "/v1/books/{p0}",
+			docsPath: "/v1/books/{id}",
+			vars:     []string{"id"},
+		},
+		{
+			tmpl:     "/v1/{name=shelves/*/books/*}",
+			pattern:  "/v1/shelves/{p0}/books/{p1}",
+			docsPath: "/v1/{name}",
+			vars:     []string{"name"},
+		},
+		{
+			tmpl:     "/v1/{shelf.id}/books/{book_id}:archive",
+			pattern:  "/v1/{p0}/books/{p1}:archive",
+			docsPath: "/v1/{shelf.id}/books/{book_id}:archive",
+			vars:     []string{"shelf.id", "book_id"},
+		},
+		{
+			tmpl:     "/v1/files/{path=**}",
+			pattern:  "/v1/files/*",
+			docsPath: "/v1/files/{path}",
+			vars:     []string{"path"},
+		},
+		{
+			tmpl: "v1/books",
+			err:  true,
+		},
+		{
+			tmpl: "/v1/{path=**}/books",
+			err:  true,
+		},
+		{
+			tmpl: "/v1/{name",
+			err:  true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.tmpl, func(t *testing.T) {
+			p, err := parsePathTemplate(tc.tmpl)
+			if tc.err {
+				require.ErrorIs(t, err, errInvalidPathTemplate)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tc.pattern, p.pattern)
+			require.Equal(t, tc.docsPath, p.docsPath)
+			var vars []string
+			for _, v := range p.vars {
+				vars = append(vars, v.fieldPath)
+			}
+			require.Equal(t, tc.vars, vars)
+		})
+	}
+}
+
+func TestRESTTranscoding(t *testing.T) {
+	method := newTestBooksFile(t).Services().ByName("BookService").Methods().ByName("GetBook")
+	procedure := "/test.books.BookService/GetBook"
+
+	s := newTestServer(t)
+	h := connect.NewUnaryHandler(procedure,
+		func(_ context.Context, req *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			msg := req.Msg.ProtoReflect()
+			fields := method.Input().Fields()
+			name := msg.Get(fields.ByName("name")).String()
+			if name == "shelves/1/books/missing" {
+				return nil, connect.NewError(connect.CodeNotFound, nil)
+			}
+
+			title := msg.Get(fields.ByName("new_book")).Message().Get(method.Output().Fields().ByName("title")).String()
+			if title == "" {
+				var tags []string
+				list := msg.Get(fields.ByName("tags")).List()
+				for i := range list.Len() {
+					tags = append(tags, list.Get(i).String())
+				}
+				title = fmt.Sprintf("%d %s", msg.Get(fields.ByName("page_size")).Int(), strings.Join(tags, ","))
+			}
+
+			res := dynamicpb.NewMessage(method.Output())
+			res.Set(method.Output().Fields().ByName("name"), protoreflect.ValueOfString(name))
+			res.Set(method.Output().Fields().ByName("title"), protoreflect.ValueOfString(title))
+			return connect.NewResponse(res), nil
+		},
+		connect.WithSchema(method),
+		connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+			*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(method.Input()) //nolint:forcetypeassert
+			return nil
+		}),
+	)
+	mountRESTRoutes(s, procedure, method, h, nil)
+	require.Len(t, s.restRoutes, 3)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+
+		status int
+		res    string
+	}{
+		{
+			name:   "path and query",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/2?pageSize=10&tags=a&tags=b&unknown=1",
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1/books/2","title":"10 a,b"}`,
+		},
+		{
+			name:   "body field",
+			method: http.MethodPost,
+			path:   "/v1/shelves/1/books",
+			body:   `{"title":"Go"}`,
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1","title":"Go"}`,
+		},
+		{
+			name:   "escaped path",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/a%2525",
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1/books/a%25","title":"0 "}`,
+		},
+		{
+			name:   "escaped slash in path",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/a%2Fb",
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1/books/a/b","title":"0 "}`,
+		},
+		{
+			name:   "path field in query",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/2?name=other",
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1/books/2","title":"0 "}`,
+		},
+		{
+			name:   "body field in query",
+			method: http.MethodPost,
+			path:   "/v1/shelves/1/books?new_book.title=Query&newBook.title=Query",
+			body:   `{"title":"Go"}`,
+			status: http.StatusOK,
+			res:    `{"name":"shelves/1","title":"Go"}`,
+		},
+		{
+			name:   "response body",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/2:title?page_size=5",
+			status: http.StatusOK,
+			res:    `"5 "`,
+		},
+		{
+			name:   "invalid query",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/2?pageSize=abc",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid body",
+			method: http.MethodPost,
+			path:   "/v1/shelves/1/books",
+			body:   `{"unknown":"Go"}`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "handler error",
+			method: http.MethodGet,
+			path:   "/v1/shelves/1/books/missing",
+			status: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			res := httptest.NewRecorder()
+			s.mux.ServeHTTP(res, req)
+			require.Equal(t, tc.status, res.Code, res.Body.String())
+			if tc.res != "" {
+				require.JSONEq(t, tc.res, res.Body.String())
+			}
+		})
+	}
+
+	spec, err := (&restDocsPlugin{routes: s.restRoutes}).GenerateSpecification()
+	require.NoError(t, err)
+	require.Len(t, spec.Services, 1)
+	require.Equal(t, "test.books.BookService (REST)", spec.Services[0].Name)
+	require.Len(t, spec.Services[0].Methods, 3)
+	require.Equal(t, "/v1/{name}", spec.Services[0].Methods[0].Endpoints[0].PathMapping)
+	require.Equal(t, http.MethodGet, spec.Services[0].Methods[0].HTTPMethod)
+	require.Equal(t, http.MethodPost, spec.Services[0].Methods[1].HTTPMethod)
+	require.NotEqual(t, spec.Services[0].Methods[0].ID, spec.Services[0].Methods[2].ID)
+}
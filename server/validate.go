@@ -0,0 +1,131 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"buf.build/go/protovalidate"
+	"connectrpc.com/connect"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/proto"
+)
+
+var errInvalidResponse = errors.New("server returned an invalid response")
+
+// validateInterceptor validates messages against the buf.validate constraints
+// declared in their protos.
+type validateInterceptor struct {
+	// responses validates response messages instead of request messages.
+	responses bool
+}
+
+func (i *validateInterceptor) WrapUnary(next connect.UnaryFunc) connect.UnaryFunc {
+	return func(ctx context.Context, req connect.AnyRequest) (connect.AnyResponse, error) {
+		if !i.responses {
+			if err := validateRequest(req.Any()); err != nil {
+				return nil, err
+			}
+			return next(ctx, req)
+		}
+
+		res, err := next(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		if err := validateResponse(ctx, res.Any()); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+}
+
+func (i *validateInterceptor) WrapStreamingClient(next connect.StreamingClientFunc) connect.StreamingClientFunc {
+	return next
+}
+
+func (i *validateInterceptor) WrapStreamingHandler(next connect.StreamingHandlerFunc) connect.StreamingHandlerFunc {
+	return func(ctx context.Context, conn connect.StreamingHandlerConn) error {
+		return next(ctx, &validatingHandlerConn{StreamingHandlerConn: conn, ctx: ctx, responses: i.responses})
+	}
+}
+
+type validatingHandlerConn struct {
+	connect.StreamingHandlerConn
+
+	ctx       context.Context
+	responses bool
+}
+
+func (c *validatingHandlerConn) Receive(msg any) error {
+	if err := c.StreamingHandlerConn.Receive(msg); err != nil {
+		return err //nolint:wrapcheck // connect errors must be returned as is
+	}
+	if c.responses {
+		return nil
+	}
+	return validateRequest(msg)
+}
+
+func (c *validatingHandlerConn) Send(msg any) error {
+	if c.responses {
+		if err := validateResponse(c.ctx, msg); err != nil {
+			return err
+		}
+	}
+	return c.StreamingHandlerConn.Send(msg) //nolint:wrapcheck // connect errors must be returned as is
+}
+
+// validateRequest validates a request message, returning an invalid argument error
+// with the violations as BadRequest details if it is invalid. Errors from invalid
+// constraints are returned as is, to be converted to an internal error for clients.
+func validateRequest(msg any) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	err := protovalidate.Validate(m)
+	if err == nil {
+		return nil
+	}
+
+	var verr *protovalidate.ValidationError
+	if !errors.As(err, &verr) {
+		// Compilation or runtime errors are from invalid constraints, not the request, so
+		// they are only logged and clients receive an internal error.
+		return fmt.Errorf("server: validating request: %w", err)
+	}
+
+	cerr := connect.NewError(connect.CodeInvalidArgument, err)
+	br := &errdetails.BadRequest{
+		FieldViolations: make([]*errdetails.BadRequest_FieldViolation, len(verr.Violations)),
+	}
+	for i, v := range verr.Violations {
+		br.FieldViolations[i] = &errdetails.BadRequest_FieldViolation{
+			Field:       protovalidate.FieldPathString(v.Proto.GetField()),
+			Description: v.Proto.GetMessage(),
+			Reason:      v.Proto.GetRuleId(),
+		}
+	}
+	if d, err := connect.NewErrorDetail(br); err == nil {
+		cerr.AddDetail(d)
+	}
+	return cerr
+}
+
+// validateResponse validates a response message, returning an internal error if it is
+// invalid since it indicates a bug in the server.
+func validateResponse(ctx context.Context, msg any) error {
+	m, ok := msg.(proto.Message)
+	if !ok {
+		return nil
+	}
+
+	if err := protovalidate.Validate(m); err != nil {
+		slog.ErrorContext(ctx, "Invalid response message", "error", err)
+		return connect.NewError(connect.CodeInternal, errInvalidResponse)
+	}
+	return nil
+}
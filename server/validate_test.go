@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"connectrpc.com/connect"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/types/dynamicpb"
+)
+
+func TestValidateInterceptor(t *testing.T) {
+	desc := newTestBooksFile(t).Messages().ByName("ListBooksRequest")
+	newMsg := func(name string, pageSize int32) *dynamicpb.Message {
+		msg := dynamicpb.NewMessage(desc)
+		msg.Set(desc.Fields().ByName("name"), protoreflect.ValueOfString(name))
+		msg.Set(desc.Fields().ByName("page_size"), protoreflect.ValueOfInt32(pageSize))
+		return msg
+	}
+
+	tests := []struct {
+		name      string
+		req       *dynamicpb.Message
+		res       *dynamicpb.Message
+		responses bool
+
+		code       connect.Code
+		violations []string
+	}{
+		{
+			name: "valid request",
+			req:  newMsg("books/1", 10),
+			res:  newMsg("", -1),
+		},
+		{
+			name:       "invalid request",
+			req:        newMsg("", 10),
+			code:       connect.CodeInvalidArgument,
+			violations: []string{"name"},
+		},
+		{
+			name:       "multiple violations",
+			req:        newMsg("", 1000),
+			code:       connect.CodeInvalidArgument,
+			violations: []string{"name", "page_size"},
+		},
+		{
+			name:      "valid response",
+			req:       newMsg("", -1),
+			res:       newMsg("books/1", 10),
+			responses: true,
+		},
+		{
+			name:      "invalid response",
+			req:       newMsg("books/1", 10),
+			res:       newMsg("books/1", -1),
+			responses: true,
+			code:      connect.CodeInternal,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			interceptor := &validateInterceptor{responses: tc.responses}
+			call := interceptor.WrapUnary(func(_ context.Context, _ connect.AnyRequest) (connect.AnyResponse, error) {
+				return connect.NewResponse(tc.res), nil
+			})
+
+			_, err := call(t.Context(), connect.NewRequest(tc.req))
+			if tc.code == 0 {
+				require.NoError(t, err)
+				return
+			}
+			require.Equal(t, tc.code, connect.CodeOf(err))
+			if tc.violations == nil {
+				return
+			}
+
+			var cerr *connect.Error
+			require.ErrorAs(t, err, &cerr)
+			require.Len(t, cerr.Details(), 1)
+			detail, err := cerr.Details()[0].Value()
+			require.NoError(t, err)
+			br, ok := detail.(*errdetails.BadRequest)
+			require.True(t, ok)
+			var fields []string
+			for _, v := range br.GetFieldViolations() {
+				fields = append(fields, v.GetField())
+				require.NotEmpty(t, v.GetDescription())
+			}
+			require.ElementsMatch(t, tc.violations, fields)
+		})
+	}
+}
+
+func TestValidateAfterAuth(t *testing.T) {
+	desc := newTestBooksFile(t).Messages().ByName("ListBooksRequest")
+	auth := connect.UnaryInterceptorFunc(func(connect.UnaryFunc) connect.UnaryFunc {
+		return func(context.Context, connect.AnyRequest) (connect.AnyResponse, error) {
+			return nil, connect.NewError(connect.CodeUnauthenticated, errMissingToken)
+		}
+	})
+
+	opts := append(connectHandlerOptions(auth), connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+		*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(desc) //nolint:forcetypeassert
+		return nil
+	}))
+	h := connect.NewUnaryHandler("/test.books.BookService/ListBooks",
+		func(context.Context, *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			return connect.NewResponse(dynamicpb.NewMessage(desc)), nil
+		},
+		opts...,
+	)
+
+	// The request is invalid, but unauthenticated callers should not see validation errors.
+	req := httptest.NewRequest(http.MethodPost, "/test.books.BookService/ListBooks", strings.NewReader(`{}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	require.Equal(t, http.StatusUnauthorized, res.Code)
+}
+
+func TestValidateInvalidRules(t *testing.T) {
+	desc := newTestBooksFile(t).Messages().ByName("DeleteBookRequest")
+	opts := append(ConnectHandlerOptions(), connect.WithRequestInitializer(func(_ connect.Spec, msg any) error {
+		*msg.(*dynamicpb.Message) = *dynamicpb.NewMessage(desc) //nolint:forcetypeassert
+		return nil
+	}))
+	h := connect.NewUnaryHandler("/test.books.BookService/DeleteBook",
+		func(context.Context, *connect.Request[dynamicpb.Message]) (*connect.Response[dynamicpb.Message], error) {
+			return connect.NewResponse(dynamicpb.NewMessage(desc)), nil
+		},
+		opts...,
+	)
+
+	req := httptest.NewRequest(http.MethodPost, "/test.books.BookService/DeleteBook", strings.NewReader(`{"name":"books/1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	res := httptest.NewRecorder()
+	h.ServeHTTP(res, req)
+	require.Equal(t, http.StatusInternalServerError, res.Code)
+	// The error from the invalid rule is not returned to clients.
+	require.JSONEq(t, `{"code":"internal"}`, res.Body.String())
+}
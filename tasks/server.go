@@ -22,6 +22,7 @@ type curiostackConfig struct {
 func DefineServer(opts ...ServerOption) {
 	dockerTags := flag.String("docker-tags", "dev", "Tags to add to add to built docker image.")
 	dockerLabels := flag.String("docker-labels", "", "Labels to add to add to built docker image.")
+	openAPIOut := flag.String("openapi-out", "openapi.json", "Path to write the OpenAPI document to.")
 
 	var conf serverConfig
 	for _, o := range opts {
@@ -50,6 +51,17 @@ func DefineServer(opts ...ServerOption) {
 		},
 	})
 
+	// The server is run with config.OpenAPI.OutputFile set, which writes the document
+	// in server.Start instead of serving. The server's setup before Start is executed
+	// as usual, so it must work without access to databases or other services.
+	goyek.Define(goyek.Task{
+		Name:  "openapi",
+		Usage: "Writes the OpenAPI document for the server's connect procedures.",
+		Action: func(a *goyek.A) {
+			cmd.Exec(a, "go run .", cmd.Env("SERVER_OPENAPI_OUTPUTFILE", *openAPIOut))
+		},
+	})
+
 	goyek.Define(goyek.Task{
 		Name:  "start",
 		Usage: "Starts the local server.",
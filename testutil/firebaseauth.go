@@ -0,0 +1,279 @@
+package testutil
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	firebase "firebase.google.com/go/v4"
+	"firebase.google.com/go/v4/auth"
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+)
+
+const firebaseStubKeyID = "curiostack-test-key"
+
+var errInvalidIDToken = errors.New("invalid ID token")
+
+// FirebaseAuthStub is a local stand-in for Firebase Authentication for unit tests. It
+// issues ID tokens signed with a generated key and serves the public key as a JSON Web
+// Key Set at JWKSURL, which tokens are verified against, similar to how real ID tokens are
+// verified. It implements server.FirebaseTokenVerifier and can be used in parallel tests.
+//
+// Use FirebaseAuthEmulatorStub to verify tokens with a real [auth.Client] instead.
+type FirebaseAuthStub struct {
+	// JWKSURL is the URL serving the key set used to verify tokens.
+	JWKSURL string
+
+	projectID string
+	signer    jose.Signer
+}
+
+// NewFirebaseAuthStub returns a FirebaseAuthStub issuing tokens for the given project. The
+// key set is served until the test finishes.
+func NewFirebaseAuthStub(t testing.TB, projectID string) *FirebaseAuthStub {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("curiostack/testutil: generating key: %v", err)
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", firebaseStubKeyID))
+	if err != nil {
+		t.Fatalf("curiostack/testutil: creating signer: %v", err)
+	}
+
+	jwks, err := json.Marshal(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &key.PublicKey, KeyID: firebaseStubKeyID, Algorithm: string(jose.RS256), Use: "sig"},
+	}})
+	if err != nil {
+		t.Fatalf("curiostack/testutil: marshaling key set: %v", err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write(jwks)
+	}))
+	t.Cleanup(srv.Close)
+
+	return &FirebaseAuthStub{
+		JWKSURL:   srv.URL,
+		projectID: projectID,
+		signer:    signer,
+	}
+}
+
+// IDToken returns an ID token for the given userID, valid for one hour. tenantID is
+// optional, when unset, the user is assumed to be in the default tenant. claims are
+// added to the token as custom claims.
+func (f *FirebaseAuthStub) IDToken(userID string, tenantID string, claims map[string]any) (string, error) {
+	tok, err := jwt.Signed(f.signer).Claims(firebaseTokenClaims(f.projectID, userID, tenantID, claims)).Serialize()
+	if err != nil {
+		return "", fmt.Errorf("curiostack/testutil: signing token: %w", err)
+	}
+	return tok, nil
+}
+
+// VerifyIDToken verifies an ID token issued by IDToken against the served key set.
+func (f *FirebaseAuthStub) VerifyIDToken(ctx context.Context, idToken string) (*auth.Token, error) {
+	tok, err := jwt.ParseSigned(idToken, []jose.SignatureAlgorithm{jose.RS256})
+	if err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: %w: %w", errInvalidIDToken, err)
+	}
+
+	keys, err := f.fetchKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var claims jwt.Claims
+	var all map[string]any
+	if err := tok.Claims(keys, &claims, &all); err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: %w: %w", errInvalidIDToken, err)
+	}
+	if err := claims.Validate(jwt.Expected{
+		Issuer:      "https://securetoken.google.com/" + f.projectID,
+		AnyAudience: jwt.Audience{f.projectID},
+		Time:        time.Now(),
+	}); err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: %w: %w", errInvalidIDToken, err)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("curiostack/testutil: %w: missing subject", errInvalidIDToken)
+	}
+
+	token := &auth.Token{
+		Issuer:   claims.Issuer,
+		Audience: f.projectID,
+		Expires:  claims.Expiry.Time().Unix(),
+		IssuedAt: claims.IssuedAt.Time().Unix(),
+		Subject:  claims.Subject,
+		UID:      claims.Subject,
+		Claims:   all,
+	}
+	if fb, ok := all["firebase"].(map[string]any); ok {
+		token.Firebase.SignInProvider, _ = fb["sign_in_provider"].(string)
+		token.Firebase.Tenant, _ = fb["tenant"].(string)
+	}
+	return token, nil
+}
+
+func (f *FirebaseAuthStub) fetchKeys(ctx context.Context) (*jose.JSONWebKeySet, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, f.JWKSURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: creating key set request: %w", err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: fetching key set: %w", err)
+	}
+	defer res.Body.Close()
+
+	var keys jose.JSONWebKeySet
+	if err := json.NewDecoder(res.Body).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: decoding key set: %w", err)
+	}
+	return &keys, nil
+}
+
+// FirebaseAuthEmulatorStub is a local stand-in for the Firebase Authentication emulator for
+// unit tests. It issues ID tokens in the same format as the emulator and serves the user
+// lookups made when verifying them, so tokens are verified by a real [auth.Client], the same
+// as in production other than the signature check which is skipped for the emulator.
+type FirebaseAuthEmulatorStub struct {
+	projectID string
+	srv       *httptest.Server
+
+	mu sync.Mutex
+	// users maps the ID of users that have been issued a token to whether they are disabled.
+	users map[string]bool
+}
+
+// NewFirebaseAuthEmulatorStub starts a FirebaseAuthEmulatorStub for the given project and
+// points Firebase clients created during the test at it by setting
+// FIREBASE_AUTH_EMULATOR_HOST. It is stopped when the test finishes. Like t.Setenv, it
+// cannot be used in parallel tests.
+func NewFirebaseAuthEmulatorStub(t testing.TB, projectID string) *FirebaseAuthEmulatorStub {
+	t.Helper()
+
+	f := &FirebaseAuthEmulatorStub{
+		projectID: projectID,
+		users:     map[string]bool{},
+	}
+	f.srv = httptest.NewServer(http.HandlerFunc(f.serveLookup))
+	t.Cleanup(f.srv.Close)
+	t.Setenv("FIREBASE_AUTH_EMULATOR_HOST", strings.TrimPrefix(f.srv.URL, "http://"))
+
+	return f
+}
+
+// Client returns an [auth.Client] for the stub's project that verifies tokens issued by
+// IDToken. It implements server.FirebaseTokenVerifier.
+func (f *FirebaseAuthEmulatorStub) Client(ctx context.Context) (*auth.Client, error) {
+	app, err := firebase.NewApp(ctx, &firebase.Config{ProjectID: f.projectID})
+	if err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: creating firebase app: %w", err)
+	}
+	client, err := app.Auth(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("curiostack/testutil: getting firebase auth: %w", err)
+	}
+	return client, nil
+}
+
+// IDToken returns an ID token for the given userID, valid for one hour. tenantID is
+// optional, when unset, the user is assumed to be in the default tenant. claims are
+// added to the token as custom claims.
+func (f *FirebaseAuthEmulatorStub) IDToken(userID string, tenantID string, claims map[string]any) (string, error) {
+	// The emulator issues unsigned tokens.
+	header, err := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	if err != nil {
+		return "", fmt.Errorf("curiostack/testutil: marshaling token header: %w", err)
+	}
+	body, err := json.Marshal(firebaseTokenClaims(f.projectID, userID, tenantID, claims))
+	if err != nil {
+		return "", fmt.Errorf("curiostack/testutil: marshaling token claims: %w", err)
+	}
+
+	f.mu.Lock()
+	if _, ok := f.users[userID]; !ok {
+		f.users[userID] = false
+	}
+	f.mu.Unlock()
+
+	return base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(body) + ".", nil
+}
+
+// DisableUser disables the user with the given userID, so their tokens are rejected.
+func (f *FirebaseAuthEmulatorStub) DisableUser(userID string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.users[userID] = true
+}
+
+// serveLookup serves the accounts:lookup API used by auth.Client to check that the user of
+// a token issued by the emulator exists and is not disabled.
+func (f *FirebaseAuthEmulatorStub) serveLookup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, "/accounts:lookup") {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req struct {
+		LocalID []string `json:"localId"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	type user struct {
+		LocalID  string `json:"localId"`
+		Disabled bool   `json:"disabled,omitempty"`
+	}
+	var res struct {
+		Users []user `json:"users,omitempty"`
+	}
+	f.mu.Lock()
+	for _, id := range req.LocalID {
+		if disabled, ok := f.users[id]; ok {
+			res.Users = append(res.Users, user{LocalID: id, Disabled: disabled})
+		}
+	}
+	f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(&res)
+}
+
+// firebaseTokenClaims returns the claims of an ID token for userID issued by the project.
+func firebaseTokenClaims(projectID string, userID string, tenantID string, claims map[string]any) map[string]any {
+	now := time.Now()
+	firebase := map[string]any{"sign_in_provider": "custom"}
+	if tenantID != "" {
+		firebase["tenant"] = tenantID
+	}
+
+	payload := map[string]any{}
+	for k, v := range claims {
+		payload[k] = v
+	}
+	payload["iss"] = "https://securetoken.google.com/" + projectID
+	payload["aud"] = projectID
+	payload["sub"] = userID
+	payload["iat"] = now.Unix()
+	payload["auth_time"] = now.Unix()
+	payload["exp"] = now.Add(time.Hour).Unix()
+	payload["firebase"] = firebase
+	return payload
+}
@@ -0,0 +1,60 @@
+package testutil
+
+import (
+	"testing"
+
+	"firebase.google.com/go/v4/auth"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFirebaseAuthStub(t *testing.T) {
+	t.Parallel()
+
+	stub := NewFirebaseAuthStub(t, "test-project")
+
+	token, err := stub.IDToken("user", "tenant", map[string]any{"admin": true})
+	require.NoError(t, err)
+
+	decoded, err := stub.VerifyIDToken(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "user", decoded.UID)
+	require.Equal(t, "tenant", decoded.Firebase.Tenant)
+	require.Equal(t, "test-project", decoded.Audience)
+	require.Equal(t, true, decoded.Claims["admin"])
+
+	other := NewFirebaseAuthStub(t, "test-project")
+	_, err = other.VerifyIDToken(t.Context(), token)
+	require.ErrorIs(t, err, errInvalidIDToken)
+
+	_, err = stub.VerifyIDToken(t.Context(), "not-a-token")
+	require.ErrorIs(t, err, errInvalidIDToken)
+}
+
+func TestFirebaseAuthEmulatorStub(t *testing.T) {
+	stub := NewFirebaseAuthEmulatorStub(t, "test-project")
+	client, err := stub.Client(t.Context())
+	require.NoError(t, err)
+
+	token, err := stub.IDToken("user", "tenant", map[string]any{"admin": true})
+	require.NoError(t, err)
+
+	decoded, err := client.VerifyIDToken(t.Context(), token)
+	require.NoError(t, err)
+	require.Equal(t, "user", decoded.UID)
+	require.Equal(t, "tenant", decoded.Firebase.Tenant)
+	require.Equal(t, "test-project", decoded.Audience)
+	require.Equal(t, true, decoded.Claims["admin"])
+
+	stub.DisableUser("user")
+	_, err = client.VerifyIDToken(t.Context(), token)
+	require.True(t, auth.IsUserDisabled(err))
+
+	_, err = client.VerifyIDToken(t.Context(), "not-a-token")
+	require.True(t, auth.IsIDTokenInvalid(err))
+
+	other := &FirebaseAuthEmulatorStub{projectID: "other-project", users: map[string]bool{}}
+	otherToken, err := other.IDToken("user", "", nil)
+	require.NoError(t, err)
+	_, err = client.VerifyIDToken(t.Context(), otherToken)
+	require.True(t, auth.IsIDTokenInvalid(err))
+}